@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+// CheckConfigAction validates the config file overridden with command line flags, and message templates.
+// It returns error when any problem is found, for CI use.
+func CheckConfigAction(c *cli.Context) error {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+
+	problems := validateConfig(conf)
+	for _, p := range problems {
+		fmt.Printf("%s: %s\n", c.String("config"), p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s) found in '%s'", len(problems), c.String("config"))
+	}
+	fmt.Printf("%s: no problems found.\n", c.String("config"))
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/livesense-inc/wg-logger/internal/kvs"
+	"github.com/livesense-inc/wg-logger/pkg/event"
+	"github.com/livesense-inc/wg-logger/pkg/wglogger"
+	"github.com/urfave/cli/v2"
+)
+
+// cacheBucket is the bucket name to store peer records
+const cacheBucket = wglogger.StateBucket
+
+// MigrateDBAction copies the bbolt database into a SQLite database.
+func MigrateDBAction(c *cli.Context) error {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+
+	src := c.String("from")
+	if src == "" {
+		src = conf.Database
+	}
+	dst := c.String("to")
+	if dst == "" || dst == src {
+		return fmt.Errorf("destination database path '%s' is invalid", dst)
+	}
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return fmt.Errorf("source database '%s' is not found", src)
+	}
+	if err := os.MkdirAll(path.Dir(dst), 0770); err != nil {
+		return err
+	}
+
+	srcStore, err := kvs.Open(src, cacheBucket)
+	if err != nil {
+		return fmt.Errorf("open database '%s' failed: %w", src, err)
+	}
+	defer srcStore.Close()
+
+	dstStore, err := kvs.OpenSQLite(dst, cacheBucket)
+	if err != nil {
+		return fmt.Errorf("open database '%s' failed: %w", dst, err)
+	}
+	defer dstStore.Close()
+
+	states, records, err := kvs.Copy(dstStore, srcStore)
+	if err != nil {
+		return fmt.Errorf("migration from '%s' to '%s' failed: %w", src, dst, err)
+	}
+	fmt.Printf("%d keys and %d history records were copied from '%s' to '%s'.\n", states, records, src, dst)
+	fmt.Printf("set 'database = \"%s\"' and 'database_driver = \"%s\"' to use it.\n", dst, kvs.DriverSQLite)
+	return nil
+}
+
+// openDatabase opens the cache database in config.
+func openDatabase(c *cli.Context) (kvs.Store, error) {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Database == "" {
+		return nil, fmt.Errorf("database path '%s' is invalid", conf.Database)
+	}
+	if err := os.MkdirAll(path.Dir(conf.Database), 0770); err != nil {
+		return nil, err
+	}
+	store, err := kvs.OpenStore(conf.DatabaseDriver, conf.Database, cacheBucket)
+	if err != nil {
+		return nil, fmt.Errorf("open database '%s' failed: %w", conf.Database, err)
+	}
+	return store, nil
+}
+
+// DBExportAction writes every entry of the database as JSON Lines.
+func DBExportAction(c *cli.Context) error {
+	store, err := openDatabase(c)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var w io.Writer = os.Stdout
+	if output := c.String("output"); output != "" && output != "-" {
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	entries, err := kvs.Export(store, w)
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "%d entries were exported.\n", entries)
+	return nil
+}
+
+// validateEntry checks that peer records can be read as event.Peer.
+func validateEntry(e kvs.Entry) error {
+	if e.Bucket != cacheBucket && !e.IsHistory() {
+		return nil
+	}
+	var stat event.Peer
+	dec := json.NewDecoder(bytes.NewReader(e.Value))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&stat); err != nil {
+		return fmt.Errorf("invalid peer record '%s': %w", e.Key, err)
+	}
+	if stat.PublicKey != e.Key {
+		return fmt.Errorf("public key of peer record '%s' is mismatched: '%s'", e.Key, stat.PublicKey)
+	}
+	return nil
+}
+
+// DBImportAction validates JSON Lines written by DBExportAction and writes them into the database.
+func DBImportAction(c *cli.Context) error {
+	var r io.Reader = os.Stdin
+	if input := c.String("input"); input != "" && input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	// validate all entries before writing
+	_, entries, err := kvs.ReadDump(r, cacheBucket, validateEntry)
+	if err != nil {
+		return fmt.Errorf("invalid dump data: %w", err)
+	}
+
+	store, err := openDatabase(c)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if !c.Bool("force") {
+		empty, err := kvs.IsEmpty(store)
+		if err != nil {
+			return fmt.Errorf("cannot read database: %w", err)
+		}
+		if !empty {
+			return fmt.Errorf("database is not empty. use '--force' to overwrite it")
+		}
+	}
+
+	if err := kvs.Import(store, entries); err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "%d entries were imported.\n", len(entries))
+	return nil
+}
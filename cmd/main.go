@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -13,246 +13,81 @@ import (
 	"github.com/livesense-inc/wg-logger/internal/config"
 	"github.com/livesense-inc/wg-logger/internal/kvs"
 	"github.com/livesense-inc/wg-logger/internal/logger"
+	"github.com/livesense-inc/wg-logger/internal/peerdir"
 	"github.com/livesense-inc/wg-logger/internal/wgconf"
-	"github.com/livesense-inc/wg-logger/internal/wgpeerstat"
+	"github.com/livesense-inc/wg-logger/pkg/wglogger"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 )
 
-func bytesReadable(b uint64) string {
-	const unit = 1024
-	if b < unit {
-		return fmt.Sprintf("%dB", b)
-	}
-	div, exp := uint64(unit), 0
-	for n := b / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
-}
-
-type WGPeerStatLog struct {
-	wgpeerstat.PeerStat
-	EndpointIP                string
-	TransferedRXPerEndpoint   uint64
-	TransferedTXPerEndpoint   uint64
-	TransferedRXPerEndpointIP uint64
-	TransferedTXPerEndpointIP uint64
-	SuspectedInactive         bool
+// configFlags maps command line flags to config keys they override
+var configFlags = []struct {
+	flag string
+	key  string
+}{
+	{"loglevel", "log_level"},
+	{"log-output", "log_output"},
+	{"wireguard-config", "wg_conf"},
+	{"database", "database"},
+	{"database-driver", "database_driver"},
+	{"interval", "interval"},
+	{"inactive-threshold", "suspected_inactive_threshold"},
+	{"wg-tools-path", "wg_tools_path"},
 }
 
-func (s WGPeerStatLog) MarshalZerologObject(e *zerolog.Event) {
-	e.Str("public_key", s.PublicKey).
-		Str("endpoint", s.Endpoint).
-		Str("endpoint_ip", s.EndpointIP).
-		Time("latest_handshake", s.LatestHandshake).
-		Str("transfered_rx_per_endpoint", bytesReadable(s.TransferedRXPerEndpoint)).
-		Str("transfered_tx_per_endpoint", bytesReadable(s.TransferedTXPerEndpoint)).
-		Str("transfered_rx_per_endpoint_ip", bytesReadable(s.TransferedRXPerEndpointIP)).
-		Str("transfered_tx_per_endpoint_ip", bytesReadable(s.TransferedTXPerEndpointIP))
-}
-
-type WGLogger struct {
-	Cache                      *kvs.KVS
-	WGConf                     *wgconf.WGConf
-	EventLogger                *zerolog.Logger
-	DaemonLogger               *zerolog.Logger
-	Interval                   int64
-	SuspectedInactiveThreshold int64
-	WgCommandPath              string
+// flagValue returns the value of the flag set in the context or its parents.
+// Value of cli.Context looks up flags of the command only, not global flags given to subcommands.
+func flagValue(c *cli.Context, name string) interface{} {
+	for _, ctx := range c.Lineage() {
+		for _, local := range ctx.LocalFlagNames() {
+			if local == name {
+				return ctx.Value(name)
+			}
+		}
+	}
+	return nil
 }
 
-func (wgl *WGLogger) check() (err error) {
-	wgl.DaemonLogger.Debug().
-		Msg("check")
-	names, err := wgl.WGConf.GetFriendlyNameMap()
+// loadConfig reads the config file and overrides it with WG_LOGGER_* environment variables,
+// then command line flags.
+func loadConfig(c *cli.Context) (*config.Config, error) {
+	configPath := c.String("config")
+	conf, err := config.GetConfig(configPath)
 	if err != nil {
-		wgl.DaemonLogger.Error().
-			Err(err).
-			Msgf("Cannot read '%s'", wgl.WGConf.Path)
-		return
+		return conf, fmt.Errorf("cannot read config file: %w", err)
 	}
 
-	stats, err := wgpeerstat.GetPeerStats(wgl.WgCommandPath)
-	if err != nil {
-		wgl.DaemonLogger.Error().
-			Err(err).
-			Msg("Cannot check wg-tool")
-		return
+	if err = conf.ApplyEnv(os.LookupEnv); err != nil {
+		return conf, err
 	}
 
-	for _, stat := range stats {
-		var lastStat WGPeerStatLog
-		v := wgl.Cache.Get(stat.PublicKey)
-		if v == nil {
-			lastStat = WGPeerStatLog{
-				PeerStat: wgpeerstat.PeerStat{
-					LatestHandshake: time.Unix(0, 0),
-				},
-			}
-		} else {
-			if err = json.Unmarshal(v, &lastStat); err != nil {
-				wgl.DaemonLogger.Error().
-					Err(err).
-					Msgf("Invalid data was inserted into database '%s'", wgl.Cache.DBPath)
-				return err
-			}
-		}
-
-		endpointIP := "(none)"
-		if i := strings.LastIndex(stat.Endpoint, ":"); i > 0 {
-			endpointIP = stat.Endpoint[0:i]
-		}
-
-		// if counter was rotated, use current value as transfered bytes.
-		transferedRX := stat.TransferRX - lastStat.TransferRX
-		if stat.TransferRX < lastStat.TransferRX {
-			wgl.DaemonLogger.Info().
-				Object("peer", stat).
-				Msg("TransferRX counter was rotated")
-			transferedRX = stat.TransferRX
-		}
-		transferedTX := stat.TransferTX - lastStat.TransferTX
-		if stat.TransferTX < lastStat.TransferTX {
-			wgl.DaemonLogger.Info().
-				Object("peer", stat).
-				Msg("TransferTX counter was rotated")
-			transferedTX = stat.TransferTX
-		}
-
-		curStat := WGPeerStatLog{
-			PeerStat:                  stat,
-			EndpointIP:                endpointIP,
-			TransferedRXPerEndpoint:   lastStat.TransferedRXPerEndpoint + transferedRX,
-			TransferedTXPerEndpoint:   lastStat.TransferedTXPerEndpoint + transferedTX,
-			TransferedRXPerEndpointIP: lastStat.TransferedRXPerEndpointIP + transferedRX,
-			TransferedTXPerEndpointIP: lastStat.TransferedTXPerEndpointIP + transferedTX,
-		}
-
-		if curStat.EndpointIP != lastStat.EndpointIP {
-			// EndpointIP changed
-
-			// output final stat of last endpoint
-			finalStat := curStat
-			finalStat.Endpoint = lastStat.Endpoint
-			finalStat.EndpointIP = lastStat.EndpointIP
-			finalStat.LatestHandshake = lastStat.LatestHandshake
-			wgl.EventLogger.Log().
-				Str("event", "statistics").
-				Str("friendly_name", names[curStat.PublicKey]).
-				Time("event_time", curStat.LatestHandshake).
-				Object("peer", finalStat).
-				Msg("endpoint statistics")
-
-			// initialize stat and output first information
-			curStat.TransferedRXPerEndpoint = 0
-			curStat.TransferedTXPerEndpoint = 0
-			curStat.TransferedRXPerEndpointIP = 0
-			curStat.TransferedTXPerEndpointIP = 0
-			curStat.SuspectedInactive = false
-			wgl.EventLogger.Log().
-				Str("event", "endpoint_ip updated").
-				Str("friendly_name", names[curStat.PublicKey]).
-				Time("event_time", curStat.LatestHandshake).
-				Object("peer", curStat).
-				Msg("status update")
-		} else if curStat.Endpoint != lastStat.Endpoint {
-			// Endpoint changed
-
-			// output final stat of last endpoint
-			finalStat := curStat
-			finalStat.Endpoint = lastStat.Endpoint
-			finalStat.EndpointIP = lastStat.EndpointIP
-			finalStat.LatestHandshake = lastStat.LatestHandshake
-			wgl.EventLogger.Log().
-				Str("event", "statistics").
-				Str("friendly_name", names[curStat.PublicKey]).
-				Time("event_time", curStat.LatestHandshake).
-				Object("peer", finalStat).
-				Msg("endpoint statistics")
-
-			// initialize stat and output first information
-			curStat.TransferedRXPerEndpoint = 0
-			curStat.TransferedTXPerEndpoint = 0
-			curStat.SuspectedInactive = false
-			wgl.EventLogger.Log().
-				Str("event", "endpoint updated").
-				Str("friendly_name", names[curStat.PublicKey]).
-				Time("event_time", curStat.LatestHandshake).
-				Object("peer", curStat).
-				Msg("status update")
-		} else if curStat.LatestHandshake != lastStat.LatestHandshake {
-			// Handshake occured
-			wgl.EventLogger.Log().
-				Str("event", "handshake").
-				Str("friendly_name", names[curStat.PublicKey]).
-				Time("event_time", curStat.LatestHandshake).
-				Object("peer", curStat).
-				Msg("status update")
-		} else if curStat.LatestHandshake != time.Unix(0, 0) &&
-			time.Since(curStat.LatestHandshake) > time.Minute*time.Duration(wgl.SuspectedInactiveThreshold) &&
-			curStat.TransferRX == lastStat.TransferRX &&
-			curStat.TransferTX == lastStat.TransferTX {
-			// suspect connection was inactive
-			if !lastStat.SuspectedInactive {
-				wgl.EventLogger.Log().
-					Str("event", "suspected inactive").
-					Str("friendly_name", names[curStat.PublicKey]).
-					Time("event_time", curStat.LatestHandshake).
-					Object("peer", curStat).
-					Msgf("last handshake was %d minutes ago.", int64(time.Since(curStat.LatestHandshake).Minutes()))
-			}
-			curStat.SuspectedInactive = true
+	// override configs
+	for _, f := range configFlags {
+		if !c.IsSet(f.flag) {
+			continue
 		}
-
-		// save current stat
-		data, err := json.Marshal(curStat)
-		if err != nil {
-			wgl.DaemonLogger.Error().
-				Err(err).
-				Msgf("Cannot marshal '%s' data", curStat.PublicKey)
+		if err = conf.Set(f.key, fmt.Sprint(flagValue(c, f.flag)), config.SourceFlag); err != nil {
+			return conf, fmt.Errorf("--%s: %w", f.flag, err)
 		}
-		if err = wgl.Cache.Set(curStat.PublicKey, data); err != nil {
-			wgl.DaemonLogger.
-				Err(err).
-				Msgf("Cannot store '%s' data", curStat.PublicKey)
+	}
+	// --daemon is the shorthand of '--log-output file'
+	if c.Bool("daemon") && !c.IsSet("log-output") {
+		if err = conf.Set("log_output", "file", config.SourceFlag); err != nil {
+			return conf, err
 		}
 	}
 
-	return nil
+	return conf, nil
 }
 
 func Action(c *cli.Context) error {
-	fmt.Printf("initializing wg-logger %s (rev:%s)...\n", version, gitcommit)
-	configPath := c.String("config")
-	conf, err := config.GetConfig(configPath)
+	conf, err := loadConfig(c)
 	if err != nil {
-		msg := fmt.Sprintf("Cannot read config file: %s\n", configPath)
-		fmt.Println(msg)
-		return fmt.Errorf("%s", msg)
-	}
-
-	// override configs
-	if c.String("loglevel") != "" {
-		conf.LogLevel = c.String("loglevel")
-	}
-	if c.String("wireguard-config") != "" {
-		conf.WGConf = c.String("wireguard-config")
-	}
-	if c.String("database") != "" {
-		conf.Database = c.String("database")
-	}
-	if c.Int64("interval") > 0 &&
-		c.Int64("interval") != conf.Interval {
-		conf.Interval = c.Int64("interval")
-	}
-	if c.Int64("inactive-threshold") > 0 &&
-		c.Int64("inactive-threshold") != conf.SuspectedInactiveThreshold {
-		conf.SuspectedInactiveThreshold = c.Int64("inactive-threshold")
+		return err
 	}
-	if c.String("wg-tools-path") != "" {
-		conf.WGToolsPath = c.String("wg-tools-path")
+	// stdout is kept for JSON lines only
+	if !strings.EqualFold(conf.LogOutput, "json") {
+		fmt.Printf("initializing wg-logger %s (rev:%s)...\n", version, gitcommit)
 	}
 
 	if c.Bool("config-dump") {
@@ -260,80 +95,141 @@ func Action(c *cli.Context) error {
 		return nil
 	}
 
-	var EventLogger, DaemonLogger *zerolog.Logger
-	if c.Bool("daemon") {
-		EventLogger, DaemonLogger = logger.NewFileLogger(conf)
-	} else {
-		EventLogger, DaemonLogger = logger.NewConsoleLogger(conf)
+	if problems := validateConfig(conf); len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Printf("invalid config: %s\n", p)
+		}
+		return fmt.Errorf("%d problem(s) found in config, see 'wg-logger check-config'", len(problems))
 	}
 
+	// templates are validated above
+	messages, _ := parseMessageTemplates(conf.Messages)
+
+	// the database is opened first, because it keeps logs of remote sinks in the outbox
 	if conf.Database == "" {
-		msg := fmt.Sprintf("database path '%s' is invalid", conf.Database)
-		DaemonLogger.Error().
-			Msg(msg)
-		return fmt.Errorf("%s", msg)
+		return fmt.Errorf("database path '%s' is invalid", conf.Database)
 	}
 	if err := os.MkdirAll(path.Dir(conf.Database), 0770); err != nil {
+		return fmt.Errorf("mkdir to database path '%s' failed: %w", conf.Database, err)
+	}
+	cache, err := kvs.OpenStore(conf.DatabaseDriver, conf.Database, cacheBucket)
+	if err != nil {
+		return fmt.Errorf("open database '%s' failed: %w", conf.Database, err)
+	}
+	defer cache.Close()
+
+	loggers, err := logger.New(conf, cache)
+	if err != nil {
+		return fmt.Errorf("cannot open log sinks: %w", err)
+	}
+	defer loggers.Close()
+	EventLogger, DaemonLogger := loggers.Event, loggers.Daemon
+
+	wgConf, err := wgconf.New(conf.WGConf)
+	if err != nil {
 		DaemonLogger.Error().
 			Err(err).
-			Msgf("mkdir to database path '%s' failed", conf.Database)
+			Msgf("loading wireguard config file '%s' failed", conf.WGConf)
 		return err
 	}
+	wgConf.OnChange = func(change wgconf.Change) {
+		if !change.Empty() {
+			renamed := zerolog.Arr()
+			for _, r := range change.Renamed {
+				renamed.Object(r)
+			}
+			DaemonLogger.Info().
+				Str("event", "config changed").
+				Str("path", conf.WGConf).
+				Strs("added", change.Added).
+				Strs("removed", change.Removed).
+				Array("renamed", renamed).
+				Msg("config changed")
+		}
+		// diagnostics are given only when they differ from the previous load
+		for _, d := range change.Diagnostics {
+			DaemonLogger.Warn().
+				Int("line", d.Line).
+				Msgf("wireguard config file '%s': %s", conf.WGConf, d.Message)
+		}
+	}
+	stopWatch, err := wgConf.Watch(func(err error) {
+		DaemonLogger.Warn().
+			Err(err).
+			Msgf("watching '%s' stopped, fall back to polling", conf.WGConf)
+	})
+	if err != nil {
+		DaemonLogger.Warn().
+			Err(err).
+			Msgf("cannot watch '%s', fall back to polling", conf.WGConf)
+	} else {
+		defer stopWatch()
+	}
 
-	cache, err := kvs.Open(conf.Database, "main")
+	wgConfig, _, err := wgConf.Load()
 	if err != nil {
 		DaemonLogger.Error().
 			Err(err).
-			Msgf("open database '%s' failed", conf.Database)
+			Msgf("parsing wireguard config file '%s' failed", conf.WGConf)
 		return err
 	}
-	defer cache.Close()
+	for _, d := range wgConfig.Diagnostics {
+		DaemonLogger.Warn().
+			Int("line", d.Line).
+			Msgf("wireguard config file '%s': %s", conf.WGConf, d.Message)
+	}
 
-	wgConf, err := wgconf.New(conf.WGConf)
+	peerDir, err := peerdir.NewProvider(conf, cache)
 	if err != nil {
 		DaemonLogger.Error().
 			Err(err).
-			Msgf("loading wireguard config file '%s' failed", conf.WGConf)
+			Msgf("loading peer directory (%s) failed", conf.PeerDirectoryProvider)
 		return err
 	}
 
-	wglogger := WGLogger{
+	wgl := &wglogger.WGLogger{
 		Cache:                      cache,
 		WGConf:                     wgConf,
+		PeerDir:                    peerDir,
+		PeerDirPrecedence:          conf.PeerDirectoryPrecedence,
 		EventLogger:                EventLogger,
 		DaemonLogger:               DaemonLogger,
+		Messages:                   messages,
 		Interval:                   conf.Interval,
 		SuspectedInactiveThreshold: conf.SuspectedInactiveThreshold,
 		WgCommandPath:              conf.WGToolsPath,
+		HistoryMaxAge:              time.Duration(conf.HistoryMaxDays) * 24 * time.Hour,
 	}
-
-	DaemonLogger.Warn().
-		Msg("wg-logger start")
-
-	if err = wglogger.check(); err != nil {
-		DaemonLogger.Warn().
-			Err(err).
-			Msg("Cannot check WireGuard status")
+	if conf.DumpDir != "" {
+		wgl.Recorder = wglogger.NewRecorder(conf.DumpDir, conf.DumpEvery, conf.DumpMaxDays)
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	ch := make(chan os.Signal, 1)
-	defer close(ch)
+	defer signal.Stop(ch)
 	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
-	for {
-		select {
-		case <-time.After(time.Duration(wglogger.Interval) * time.Second):
-			go func() {
-				if err = wglogger.check(); err != nil {
-					DaemonLogger.Warn().
-						Err(err).
-						Msg("Cannot check WireGuard status")
-				}
-			}()
-		case s := <-ch:
-			DaemonLogger.Warn().
-				Msgf("Signal '%s' received, shutting down wg-logger", s.String())
-			return nil
+	go func() {
+		ticker := time.NewTicker(time.Duration(conf.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				loggers.ReportOutbox()
+			case s := <-ch:
+				DaemonLogger.Warn().
+					Msgf("Signal '%s' received, shutting down wg-logger", s.String())
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
 		}
-	}
+	}()
+
+	DaemonLogger.Warn().
+		Msg("wg-logger start")
+	return wgl.Run(ctx)
 }
 
 var Flags = []cli.Flag{
@@ -352,10 +248,18 @@ var Flags = []cli.Flag{
 		Name:  "database",
 		Usage: "specify the cache database file path",
 	},
+	&cli.StringFlag{
+		Name:  "database-driver",
+		Usage: "specify the cache database driver, 'bbolt' or 'sqlite'",
+	},
 	&cli.BoolFlag{
 		Name:    "daemon",
 		Aliases: []string{"d"},
-		Usage:   "run like daemon. the outputs will be written to logfiles",
+		Usage:   "run like daemon. the outputs will be written to logfiles (same as '--log-output file')",
+	},
+	&cli.StringFlag{
+		Name:  "log-output",
+		Usage: "set log output, 'console', 'file' or 'json' (override config file)",
 	},
 	&cli.StringFlag{
 		Name:  "loglevel",
@@ -381,15 +285,101 @@ var Flags = []cli.Flag{
 	},
 }
 
+var Commands = []*cli.Command{
+	{
+		Name:  "db",
+		Usage: "manage the cache database",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "export",
+				Usage:  "export every key/record in every bucket as JSON Lines",
+				Action: DBExportAction,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "specify the output file path (default: stdout)",
+					},
+				},
+			},
+			{
+				Name:   "import",
+				Usage:  "import JSON Lines written by 'db export'",
+				Action: DBImportAction,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "input",
+						Aliases: []string{"f"},
+						Usage:   "specify the input file path (default: stdin)",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "import into the database which is not empty",
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:   "migrate-db",
+		Usage:  "copy the bbolt cache database into a sqlite database",
+		Action: MigrateDBAction,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "from",
+				Usage: "specify the source bbolt database path (default: 'database' in config)",
+			},
+			&cli.StringFlag{
+				Name:     "to",
+				Usage:    "specify the destination sqlite database path",
+				Required: true,
+			},
+		},
+	},
+	{
+		Name:   "check-config",
+		Usage:  "validate the config file and command line flags",
+		Action: CheckConfigAction,
+	},
+	{
+		Name:      "lint-wgconf",
+		Usage:     "validate the wireguard config file for wg-logger conventions",
+		ArgsUsage: "[wireguard config file path (default: 'wg_conf' in config)]",
+		Action:    LintWGConfAction,
+	},
+	{
+		Name:      "replay",
+		Usage:     "run recorded 'wg show all dump' snapshots through the event detection, and write events to stdout",
+		ArgsUsage: "<directory or file of snapshots>",
+		Action:    ReplayAction,
+	},
+	{
+		Name:      "verify-log",
+		Usage:     "verify the hash chain of the event log and its rotated files",
+		ArgsUsage: "[event log path (default: 'event_log_path' in config)]",
+		Action:    VerifyLogAction,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "key-file",
+				Usage: "specify the HMAC key file (default: 'event_log_hash_key_file' in config)",
+			},
+		},
+	},
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "wireguard-logger"
 	app.Version = fmt.Sprintf("%s (rev:%s)", version, gitcommit)
+	if version != "" {
+		logger.ProductVersion = version
+	}
 	app.Flags = Flags
 	app.Action = Action
+	app.Commands = Commands
 
 	if err := app.Run(os.Args); err != nil {
-		fmt.Println("wg-logger stopped abnormaly.")
+		fmt.Printf("wg-logger stopped abnormaly: %v\n", err)
 		os.Exit(1)
 	}
 	os.Exit(0)
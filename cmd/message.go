@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/livesense-inc/wg-logger/internal/config"
+	"github.com/livesense-inc/wg-logger/pkg/wglogger"
+)
+
+// parseMessageTemplates parses templates of [messages] in config.
+func parseMessageTemplates(c config.MessageConfig) (wglogger.Messages, []string) {
+	return wglogger.ParseMessages(c.Templates())
+}
+
+// validateConfig returns problems of the config and message templates.
+func validateConfig(conf *config.Config) []string {
+	problems := conf.Validate()
+	_, templateProblems := parseMessageTemplates(conf.Messages)
+	return append(problems, templateProblems...)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/kvs"
+	"github.com/livesense-inc/wg-logger/internal/logger"
+	"github.com/livesense-inc/wg-logger/internal/wgconf"
+	"github.com/livesense-inc/wg-logger/internal/wgpeerstat"
+	"github.com/livesense-inc/wg-logger/pkg/wglogger"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+// ReplayAction runs recorded snapshots of 'wg show all dump' through the detection of check,
+// with the clock at the time of each snapshot, and writes events to stdout.
+// The state of peers starts empty in a temporary database, so the first snapshot is like the first start.
+func ReplayAction(c *cli.Context) error {
+	path := c.Args().First()
+	if path == "" {
+		return fmt.Errorf("directory or file of snapshots is required")
+	}
+	conf, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	messages, problems := parseMessageTemplates(conf.Messages)
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "invalid config: %s\n", p)
+		}
+		return fmt.Errorf("%d problem(s) found in config, see 'wg-logger check-config'", len(problems))
+	}
+
+	snapshots, err := wgpeerstat.ReadSnapshots(path)
+	if err != nil {
+		return fmt.Errorf("cannot read snapshots: %w", err)
+	}
+	if len(snapshots) == 0 {
+		return fmt.Errorf("no snapshots found in '%s'", path)
+	}
+
+	dir, err := os.MkdirTemp("", "wg-logger-replay-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	cache, err := kvs.OpenStore(conf.DatabaseDriver, filepath.Join(dir, "replay.db"), cacheBucket)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+
+	var now time.Time
+	// 'time' field of logs is the simulated clock too
+	defer func(f func() time.Time) { zerolog.TimestampFunc = f }(zerolog.TimestampFunc)
+	zerolog.TimestampFunc = func() time.Time { return now }
+	EventLogger, DaemonLogger := logger.NewStdoutLogger(conf)
+
+	// friendly names and labels are optional, snapshots may be recorded on another host
+	var wgConf *wgconf.WGConf
+	if _, err := os.Stat(conf.WGConf); err == nil {
+		if wgConf, err = wgconf.New(conf.WGConf); err != nil {
+			return fmt.Errorf("loading wireguard config file '%s' failed: %w", conf.WGConf, err)
+		}
+	} else {
+		DaemonLogger.Warn().
+			Err(err).
+			Msg("replay without friendly names and labels")
+	}
+
+	var current wgpeerstat.Snapshot
+	wgl := &wglogger.WGLogger{
+		Cache:                      cache,
+		WGConf:                     wgConf,
+		EventLogger:                EventLogger,
+		DaemonLogger:               DaemonLogger,
+		Messages:                   messages,
+		SuspectedInactiveThreshold: conf.SuspectedInactiveThreshold,
+		Now:                        func() time.Time { return now },
+		Collector: wglogger.CollectorFunc(func() ([]wglogger.PeerStat, error) {
+			return wglogger.ParseDump(current.Lines), nil
+		}),
+	}
+	for _, current = range snapshots {
+		now = current.Time
+		DaemonLogger.Debug().
+			Int("peers", len(wglogger.ParseDump(current.Lines))).
+			Msgf("replay snapshot at %s", now.Format(time.RFC3339))
+		if err := wgl.Check(); err != nil {
+			return fmt.Errorf("snapshot at %s: %w", now.Format(time.RFC3339), err)
+		}
+	}
+	return nil
+}
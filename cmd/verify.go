@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/livesense-inc/wg-logger/internal/logger"
+	"github.com/urfave/cli/v2"
+)
+
+// VerifyLogAction walks the event log and its rotated backups, and reports
+// gaps and modifications of the hash chain.
+// It returns error when any problem is found, for CI and cron use.
+func VerifyLogAction(c *cli.Context) error {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	path := conf.EventLogPath
+	if c.Args().First() != "" {
+		path = c.Args().First()
+	}
+	keyFile := conf.EventLogHashKeyFile
+	if c.IsSet("key-file") {
+		keyFile = c.String("key-file")
+	}
+	if keyFile == "" {
+		return fmt.Errorf("event_log_hash_key_file is not set, use --key-file")
+	}
+	key, err := logger.ReadChainKey(keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot read hash key: %w", err)
+	}
+
+	files, err := logger.LogFiles(path)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no log files found for '%s'", path)
+	}
+	result, err := logger.VerifyChain(files, key)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range result.Problems {
+		fmt.Println(p)
+	}
+	if result.Rotated {
+		fmt.Printf("%s: lines before seq %d are in deleted backups and not verified.\n", path, result.FirstSeq)
+	}
+	if result.Unchained > 0 {
+		fmt.Printf("%s: %d line(s) before the chain are not verified.\n", path, result.Unchained)
+	}
+	if len(result.Problems) > 0 {
+		return fmt.Errorf("%d problem(s) found in '%s'", len(result.Problems), path)
+	}
+	if result.Lines == 0 {
+		return fmt.Errorf("no hash chained lines found in '%s'", path)
+	}
+	fmt.Printf("%s: %d file(s), seq %d-%d, no problems found.\n", path, len(files), result.FirstSeq, result.LastSeq)
+	return nil
+}
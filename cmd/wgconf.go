@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/livesense-inc/wg-logger/internal/wgconf"
+	"github.com/urfave/cli/v2"
+)
+
+// LintWGConfAction reports violations of wg-logger conventions in the wireguard config file.
+// It returns error when any problem is found, for CI use.
+func LintWGConfAction(c *cli.Context) error {
+	path := c.Args().First()
+	if path == "" {
+		conf, err := loadConfig(c)
+		if err != nil {
+			return err
+		}
+		path = conf.WGConf
+	}
+
+	config, err := wgconf.ParseFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read '%s': %w", path, err)
+	}
+
+	problems := wgconf.Lint(config)
+	for _, p := range problems {
+		fmt.Printf("%s:%d: [%s] %s\n", path, p.Line, p.Rule, p.Message)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s) found in '%s'", len(problems), path)
+	}
+	fmt.Printf("%s: %d peer(s), no problems found.\n", path, len(config.Peers))
+	return nil
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
-	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
@@ -19,30 +22,219 @@ type Config struct {
 	// LogMaxDays is the maximum number of days to retain old log files based on the
 	// timestamp encoded in their filename.
 	LogMaxDays int `toml:"log_max_days"` // keepdays
+	// LogMaxBackups is the maximum number of old log files to retain, 0 keeps all.
+	LogMaxBackups int `toml:"log_max_backups"`
+	// LogRotate is string, choosen from 'size', 'daily', 'hourly'.
+	// 'daily' and 'hourly' rotate at the start of each period, in addition to log_max_mb.
+	LogRotate string `toml:"log_rotate"`
+	// LogRotateUTC uses UTC for periods of LogRotate and timestamps of rotated files, instead of local time.
+	LogRotateUTC bool `toml:"log_rotate_utc"`
+	// LogCompress compresses rotated log files with gzip.
+	LogCompress bool `toml:"log_compress"`
+	// LogFileMode is the permission of created log files in octal, e.g. '0640'.
+	LogFileMode string `toml:"log_file_mode"`
+	// LogFileOwner is the owner of created log files, 'user', 'user:group' or ':group'.
+	// Empty keeps the owner of the process.
+	LogFileOwner string `toml:"log_file_owner"`
 	// LogLevel is string, choosen from 'error', 'warn', 'info', 'debug'
 	LogLevel string `toml:"log_level"`
+	// LogOutput is string, choosen from 'console', 'file', 'json', 'none'.
+	// 'json' writes event log to stdout and daemon log to stderr for containers.
+	// 'none' writes logs to Sinks only.
+	LogOutput string `toml:"log_output"`
+	// EventLogFormat is string, choosen from 'json', 'logfmt', 'cef', 'leef'.
+	// It is the format of event log written by log_output 'file' and 'json'.
+	EventLogFormat string `toml:"event_log_format"`
+	// EventLogHashKeyFile is the path to the HMAC key file. When it is set, each line of
+	// event_log_path has 'seq' and 'prev_hash' fields, which are checked by 'verify-log'.
+	EventLogHashKeyFile string `toml:"event_log_hash_key_file"`
 	// WGConf is the path to wireguard config file
 	WGConf string `toml:"wg_conf"`
 	// Database is the path to database file (peristent data)
 	Database string `toml:"database"`
+	// DatabaseDriver is the database backend, choosen from 'bbolt', 'sqlite'
+	DatabaseDriver string `toml:"database_driver"`
+	// HistoryMaxDays is the number of days to retain the event history in the database, 0 keeps all
+	HistoryMaxDays int64 `toml:"history_max_days"`
 	// Interval is the interval time in seconds to check wireguard status
 	Interval int64 `toml:"interval"`
 	// SuspectedInactiveThreshold is the threshold time in minutes to detect event 'suspected inactive'
 	SuspectedInactiveThreshold int64 `toml:"suspected_inactive_threshold"`
 	// WGToolsPath is the path to wg-tools(wg) command
 	WGToolsPath string `toml:"wg_tools_path"`
+	// DumpDir is the directory to record outputs of 'wg show all dump' for 'replay', empty disables it
+	DumpDir string `toml:"dump_dir"`
+	// DumpEvery records a snapshot every N checks of Interval
+	DumpEvery int64 `toml:"dump_every"`
+	// DumpMaxDays is the number of days to retain snapshots, 0 keeps all
+	DumpMaxDays int64 `toml:"dump_max_days"`
+	// PeerDirectory is the path to CSV/JSON/YAML file mapping public key to name, owner, email, team
+	PeerDirectory string `toml:"peer_directory"`
+	// PeerDirectoryPrecedence is string, choosen from 'wgconf', 'directory'
+	PeerDirectoryPrecedence string `toml:"peer_directory_precedence"`
+	// PeerDirectoryProvider is string, choosen from 'file', 'ldap', 'http'
+	PeerDirectoryProvider string `toml:"peer_directory_provider"`
+	// PeerDirectoryCacheTTL is the time in seconds to cache entries of 'ldap' and 'http' provider
+	PeerDirectoryCacheTTL int64 `toml:"peer_directory_cache_ttl"`
+	// PeerDirectoryLDAP is the settings of 'ldap' provider
+	PeerDirectoryLDAP LDAPConfig `toml:"peer_directory_ldap"`
+	// PeerDirectoryHTTP is the settings of 'http' provider
+	PeerDirectoryHTTP HTTPConfig `toml:"peer_directory_http"`
+	// Messages are templates of 'message' field of events
+	Messages MessageConfig `toml:"messages"`
+
+	// Sinks are additional outputs of logs with filters
+	Sinks []SinkConfig `toml:"sink"`
+
+	// Sources records where values come from, keyed by TOML keys. Missing keys are defaults.
+	Sources map[string]Source `toml:"-"`
+}
+
+type SinkConfig struct {
+	// Name identifies the sink in error messages, default is Type
+	Name string `toml:"name"`
+	// Type is string, choosen from 'file', 'stdout', 'stderr', 'syslog', 'webhook', 'fluent', 'gelf'
+	Type string `toml:"type"`
+	// Stream is the log to write, choosen from 'event', 'daemon'
+	Stream string `toml:"stream"`
+	// Events are event names to write, e.g. 'endpoint_ip updated'. Empty means all events.
+	Events []string `toml:"events"`
+	// Level is the minimum level, choosen from 'error', 'warn', 'info', 'debug'.
+	// Events without level are treated as 'info'.
+	Level string `toml:"level"`
+	// Format is string, choosen from 'json', 'console', 'logfmt', 'cef', 'leef'
+	Format string `toml:"format"`
+	// Path is the log file of 'file' sink, rotated like event_log_path
+	Path string `toml:"path"`
+	// Address is the server of 'syslog' ('udp://localhost:514', empty means local syslog),
+	// 'fluent' ('tcp://localhost:24224' or 'unix:///var/run/fluent.sock') and
+	// 'gelf' ('udp://localhost:12201' or 'tcp://localhost:12201') sinks
+	Address string `toml:"address"`
+	// Facility is the syslog facility, e.g. 'local0'
+	Facility string `toml:"facility"`
+	// Tag is the syslog tag, or the Fluentd tag
+	Tag string `toml:"tag"`
+	// URL receives a POST request with a JSON line for each log of 'webhook' sink
+	URL string `toml:"url"`
+	// Timeout is the timeout in seconds of 'webhook', 'fluent' and 'gelf' sinks
+	Timeout int64 `toml:"timeout"`
+	// OutboxMax is the maximum number of logs waiting in the outbox for remote sinks,
+	// logs are dropped when it is full
+	OutboxMax int `toml:"outbox_max"`
+}
+
+// IsRemote reports whether logs of the sink are delivered through the outbox.
+func (s *SinkConfig) IsRemote() bool {
+	switch strings.ToLower(s.Type) {
+	case "webhook", "fluent", "gelf":
+		return true
+	case "syslog":
+		return s.Address != ""
+	}
+	return false
+}
+
+// SinkDefault returns a sink config with default values, which are used for missing keys.
+func SinkDefault() SinkConfig {
+	return SinkConfig{
+		Stream:    "event",
+		Level:     "info",
+		Format:    "json",
+		Facility:  "local0",
+		Tag:       "wg-logger",
+		Timeout:   10,
+		OutboxMax: 100000,
+	}
 }
 
-// PrintConfig prints current config parameters as TOML
+// setDefaults fills missing keys with SinkDefault, and lower-cases keys chosen from words.
+func (s *SinkConfig) setDefaults() {
+	s.Type = strings.ToLower(s.Type)
+	s.Stream = strings.ToLower(s.Stream)
+	s.Level = strings.ToLower(s.Level)
+	s.Format = strings.ToLower(s.Format)
+	s.Facility = strings.ToLower(s.Facility)
+	d := SinkDefault()
+	if s.Stream == "" {
+		s.Stream = d.Stream
+	}
+	if s.Level == "" {
+		s.Level = d.Level
+	}
+	if s.Format == "" {
+		s.Format = d.Format
+	}
+	if s.Facility == "" {
+		s.Facility = d.Facility
+	}
+	if s.Tag == "" {
+		s.Tag = d.Tag
+	}
+	if s.Timeout == 0 {
+		s.Timeout = d.Timeout
+	}
+	if s.OutboxMax == 0 {
+		s.OutboxMax = d.OutboxMax
+	}
+	if s.Name == "" {
+		s.Name = s.Type
+	}
+}
+
+type LDAPConfig struct {
+	// URL is the LDAP server, e.g. 'ldaps://ldap.example.com'
+	URL          string `toml:"url"`
+	BindDN       string `toml:"bind_dn"`
+	BindPassword string `toml:"bind_password"`
+	BaseDN       string `toml:"base_dn"`
+	// Filter narrows down entries to search, e.g. '(objectClass=person)'
+	Filter string `toml:"filter"`
+	// *Attribute are attribute names mapped to peer information
+	PublicKeyAttribute string `toml:"public_key_attribute"`
+	NameAttribute      string `toml:"name_attribute"`
+	OwnerAttribute     string `toml:"owner_attribute"`
+	EmailAttribute     string `toml:"email_attribute"`
+	TeamAttribute      string `toml:"team_attribute"`
+	// Timeout is the timeout in seconds
+	Timeout int64 `toml:"timeout"`
+}
+
+type HTTPConfig struct {
+	// URL returns JSON array of peers, or JSON object of a peer when it contains '{public_key}'
+	URL         string `toml:"url"`
+	BearerToken string `toml:"bearer_token"`
+	// Timeout is the timeout in seconds
+	Timeout int64 `toml:"timeout"`
+}
+
+// MessageConfig are Go text/template strings of 'message' field for each event.
+// They are rendered with the event, the friendly name, labels and the status of the peer.
+type MessageConfig struct {
+	Handshake         string `toml:"handshake"`
+	EndpointIPUpdated string `toml:"endpoint_ip_updated"`
+	EndpointUpdated   string `toml:"endpoint_updated"`
+	Statistics        string `toml:"statistics"`
+	SuspectedInactive string `toml:"suspected_inactive"`
+}
+
+// Templates returns templates by event names, e.g. 'endpoint_ip updated'.
+func (m MessageConfig) Templates() map[string]string {
+	return map[string]string{
+		"handshake":           m.Handshake,
+		"endpoint_ip updated": m.EndpointIPUpdated,
+		"endpoint updated":    m.EndpointUpdated,
+		"statistics":          m.Statistics,
+		"suspected inactive":  m.SuspectedInactive,
+	}
+}
+
+// PrintConfig prints current config parameters as TOML, with the source of each value
 func (c *Config) PrintConfig() {
 	fmt.Printf("\n")
-	var buffer bytes.Buffer
-	encoder := toml.NewEncoder(&buffer)
-	err := encoder.Encode(c)
-	if err != nil {
+	if err := c.Dump(os.Stdout); err != nil {
 		panic(err)
 	}
-	fmt.Printf("%v\n", buffer.String())
+	fmt.Printf("\n")
 }
 
 func GetDefault() *Config {
@@ -51,16 +243,55 @@ func GetDefault() *Config {
 		DaemonLogPath:              "/var/log/wg-logger/wg-logger.log",
 		LogMaxMB:                   100,
 		LogMaxDays:                 7,
+		LogMaxBackups:              0,
+		LogRotate:                  "size",
+		LogRotateUTC:               false,
+		LogCompress:                false,
+		LogFileMode:                "0600",
+		LogFileOwner:               "",
 		LogLevel:                   "info",
+		LogOutput:                  "console",
+		EventLogFormat:             "json",
 		WGConf:                     "/etc/wireguard/wg0.conf",
 		Database:                   "/var/log/wg-logger/wg-logger.db",
+		DatabaseDriver:             "bbolt",
+		HistoryMaxDays:             30,
 		Interval:                   30,
 		SuspectedInactiveThreshold: 30,
 		WGToolsPath:                "wg",
+		DumpDir:                    "",
+		DumpEvery:                  1,
+		DumpMaxDays:                7,
+		PeerDirectory:              "",
+		PeerDirectoryPrecedence:    "wgconf",
+		PeerDirectoryProvider:      "file",
+		PeerDirectoryCacheTTL:      3600,
+		PeerDirectoryLDAP: LDAPConfig{
+			PublicKeyAttribute: "wireguardPublicKey",
+			NameAttribute:      "cn",
+			OwnerAttribute:     "uid",
+			EmailAttribute:     "mail",
+			TeamAttribute:      "ou",
+			Timeout:            10,
+		},
+		PeerDirectoryHTTP: HTTPConfig{
+			Timeout: 10,
+		},
+		Messages: MessageConfig{
+			Handshake:         "status update",
+			EndpointIPUpdated: "status update",
+			EndpointUpdated:   "status update",
+			Statistics:        "endpoint statistics",
+			SuspectedInactive: "last handshake was {{.InactiveMinutes}} minutes ago.",
+		},
 	}
 }
 
-// GetConfig loads config file.
+// GetConfig loads config file, then files in 'include' directive and drop-in directory.
+//
+// Files are merged in the order of loading, so later values win.
+// The drop-in directory is '<conf>.d', its '*.conf' files are loaded in lexical order.
+// Paths in 'include' are relative to the including file, and can be glob patterns.
 func GetConfig(conf string) (*Config, error) {
 	if len(conf) <= 0 {
 		return GetDefault(), fmt.Errorf("you must set 'conf' option")
@@ -69,22 +300,106 @@ func GetConfig(conf string) (*Config, error) {
 		return GetDefault(), fmt.Errorf("config file '%s' is not found", conf)
 	}
 
-	f, err := os.Open(conf)
-	if err != nil {
+	// Set default values
+	config := GetDefault()
+	loaded := make(map[string]bool)
+	if err := config.load(conf, loaded); err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	buf, err := ioutil.ReadAll(f)
+	dropIns, err := filepath.Glob(filepath.Join(conf+".d", "*.conf"))
 	if err != nil {
 		return nil, err
 	}
-
-	// Set default values
-	config := GetDefault()
-	if _, err = toml.Decode(string(buf), config); err != nil {
-		return nil, err
+	sort.Strings(dropIns)
+	for _, path := range dropIns {
+		if err = config.load(path, loaded); err != nil {
+			return nil, err
+		}
 	}
 
 	return config, nil
 }
+
+// load decodes a config file over the current values, then files included by it.
+func (c *Config) load(path string, loaded map[string]bool) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if loaded[abs] {
+		// included twice or circularly
+		return nil
+	}
+	loaded[abs] = true
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var directive struct {
+		Include []string `toml:"include"`
+	}
+	if _, err = toml.Decode(string(buf), &directive); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// arrays of tables are appended to ones in the former files
+	sinks := len(c.Sinks)
+	slices := make(map[int]reflect.Value)
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).Kind() == reflect.Slice {
+			slices[i] = reflect.ValueOf(v.Field(i).Interface())
+			v.Field(i).Set(reflect.Zero(v.Field(i).Type()))
+		}
+	}
+	md, err := toml.Decode(string(buf), c)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for i, former := range slices {
+		v.Field(i).Set(reflect.AppendSlice(former, v.Field(i)))
+	}
+	c.lowerEnums()
+
+	// typos are not ignored, e.g. 'intervall = 10'
+	var unknown []string
+	for _, key := range md.Undecoded() {
+		if key.String() != "include" {
+			unknown = append(unknown, fmt.Sprintf("'%s'", key))
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown key %s in config file '%s'", strings.Join(unknown, ", "), path)
+	}
+	source := Source(fmt.Sprintf("%s:%s", SourceFile, path))
+	for _, key := range md.Keys() {
+		c.setSource(key.String(), source)
+	}
+	for i := sinks; i < len(c.Sinks); i++ {
+		c.Sinks[i].setDefaults()
+		c.setSource(fmt.Sprintf("sink.%d", i), source)
+	}
+
+	for _, pattern := range directive.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid include '%s': %w", path, pattern, err)
+		}
+		if len(paths) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("%s: included file '%s' is not found", path, pattern)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			if err = c.load(p, loaded); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -16,12 +19,45 @@ func Test_GetDefault(t *testing.T) {
 		{"DaemonLogPath", "/var/log/wg-logger/wg-logger.log"},
 		{"WGConf", "/etc/wireguard/wg0.conf"},
 		{"Database", "/var/log/wg-logger/wg-logger.db"},
+		{"DatabaseDriver", "bbolt"},
+		{"HistoryMaxDays", int64(30)},
 		{"LogMaxMB", 100},
 		{"LogMaxDays", 7},
+		{"LogMaxBackups", 0},
+		{"LogRotate", "size"},
+		{"LogRotateUTC", false},
+		{"LogCompress", false},
+		{"LogFileMode", "0600"},
+		{"LogFileOwner", ""},
 		{"LogLevel", "info"},
+		{"LogOutput", "console"},
+		{"EventLogFormat", "json"},
 		{"Interval", int64(30)},
 		{"SuspectedInactiveThreshold", int64(30)},
 		{"WGToolsPath", "wg"},
+		{"DumpDir", ""},
+		{"DumpEvery", int64(1)},
+		{"DumpMaxDays", int64(7)},
+		{"PeerDirectory", ""},
+		{"PeerDirectoryPrecedence", "wgconf"},
+		{"PeerDirectoryProvider", "file"},
+		{"PeerDirectoryCacheTTL", int64(3600)},
+		{"PeerDirectoryLDAP", LDAPConfig{
+			PublicKeyAttribute: "wireguardPublicKey",
+			NameAttribute:      "cn",
+			OwnerAttribute:     "uid",
+			EmailAttribute:     "mail",
+			TeamAttribute:      "ou",
+			Timeout:            10,
+		}},
+		{"PeerDirectoryHTTP", HTTPConfig{Timeout: 10}},
+		{"Messages", MessageConfig{
+			Handshake:         "status update",
+			EndpointIPUpdated: "status update",
+			EndpointUpdated:   "status update",
+			Statistics:        "endpoint statistics",
+			SuspectedInactive: "last handshake was {{.InactiveMinutes}} minutes ago.",
+		}},
 	}
 
 	v := reflect.Indirect(reflect.ValueOf(config))
@@ -42,14 +78,40 @@ func Test_GetConfig(t *testing.T) {
 		{"DaemonLogPath", "/var/log/wg-logger/wg-logger.log"},
 		{"WGConf", "/etc/wireguard/wg0.conf"},
 		{"Database", "/var/tmp/wg-logger.db"},
+		{"DatabaseDriver", "bbolt"},
+		{"HistoryMaxDays", int64(90)},
 		{"EventLogPath", "/var/log/wg-logger/wg.log"},
 		{"DaemonLogPath", "/var/log/wg-logger/wg-logger.log"},
 		{"LogMaxMB", 256},
 		{"LogMaxDays", 3},
+		{"LogMaxBackups", 30},
+		{"LogRotate", "size"},
+		{"LogRotateUTC", false},
+		{"LogCompress", false},
+		{"LogFileMode", "0640"},
+		{"LogFileOwner", ""},
 		{"LogLevel", "debug"},
+		{"LogOutput", "console"},
+		{"EventLogFormat", "json"},
 		{"Interval", int64(10)},
 		{"SuspectedInactiveThreshold", int64(15)},
 		{"WGToolsPath", "/usr/bin/wg"},
+		{"DumpDir", ""},
+		{"DumpEvery", int64(10)},
+		{"DumpMaxDays", int64(14)},
+		{"PeerDirectory", ""},
+		{"PeerDirectoryPrecedence", "wgconf"},
+		{"PeerDirectoryProvider", "file"},
+		{"PeerDirectoryCacheTTL", int64(1800)},
+		{"PeerDirectoryLDAP", GetDefault().PeerDirectoryLDAP},
+		{"PeerDirectoryHTTP", GetDefault().PeerDirectoryHTTP},
+		{"Messages", MessageConfig{
+			Handshake:         "status update",
+			EndpointIPUpdated: "{{.FriendlyName}} connected from {{.Peer.EndpointIP}}",
+			EndpointUpdated:   "status update",
+			Statistics:        "{{.FriendlyName}} sent {{bytes .Peer.TransferredTXPerEndpoint}} and received {{bytes .Peer.TransferredRXPerEndpoint}} from {{.Peer.Endpoint}}",
+			SuspectedInactive: "last handshake was {{.InactiveMinutes}} minutes ago.",
+		}},
 	}
 	v := reflect.Indirect(reflect.ValueOf(config))
 	for _, tt := range configTests {
@@ -58,3 +120,156 @@ func Test_GetConfig(t *testing.T) {
 		}
 	}
 }
+
+func Test_GetConfig_Fixture(t *testing.T) {
+	config, err := GetConfig("../../test/wg-logger.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configTests := []struct {
+		Name string
+		Want interface{}
+	}{
+		{"LogOutput", "file"},
+		{"LogRotate", "daily"},
+		{"LogCompress", true},
+		{"PeerDirectoryLDAP", LDAPConfig{
+			URL:                "ldaps://ldap.example.com",
+			BindDN:             "cn=wg-logger,ou=services,dc=example,dc=com",
+			BindPassword:       "secret",
+			BaseDN:             "ou=people,dc=example,dc=com",
+			Filter:             "(objectClass=person)",
+			PublicKeyAttribute: "wireguardPublicKey",
+			NameAttribute:      "cn",
+			OwnerAttribute:     "uid",
+			EmailAttribute:     "mail",
+			TeamAttribute:      "ou",
+			Timeout:            10,
+		}},
+		{"PeerDirectoryHTTP", HTTPConfig{
+			URL:         "https://inventory.example.com/wireguard/peers/{public_key}",
+			BearerToken: "secret",
+			Timeout:     5,
+		}},
+	}
+	v := reflect.Indirect(reflect.ValueOf(config))
+	for _, tt := range configTests {
+		if out := v.FieldByName(tt.Name).Interface(); !reflect.DeepEqual(out, tt.Want) {
+			t.Errorf("%s: \n out:  %#v\n want: %#v", tt.Name, out, tt.Want)
+		}
+	}
+}
+
+func Test_GetConfig_PeerDirectory(t *testing.T) {
+	config, err := GetConfig("../../test/peerdir.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.PeerDirectory != "../../test/peers.yaml" {
+		t.Errorf("PeerDirectory: %s", config.PeerDirectory)
+	}
+	if config.PeerDirectoryPrecedence != "directory" {
+		t.Errorf("PeerDirectoryPrecedence: %s", config.PeerDirectoryPrecedence)
+	}
+	for _, p := range config.Validate() {
+		if strings.HasPrefix(p, "peer_directory") {
+			t.Errorf("unexpected problem: %s", p)
+		}
+	}
+}
+
+func Test_GetConfig_UnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wg-logger.conf")
+	if err := os.WriteFile(path, []byte("intervall = 10\n[peer_directory_http]\nurll = \"http://localhost\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := GetConfig(path)
+	want := "unknown key 'intervall', 'peer_directory_http.urll' in config file '" + path + "'"
+	if err == nil || err.Error() != want {
+		t.Errorf("\n out:  %v\n want: %s", err, want)
+	}
+}
+
+func Test_GetConfig_Include(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "wg-logger.conf")
+	files := map[string]string{
+		conf:                            "include = [\"ldap.conf\", \"extra/*.conf\"]\ninterval = 10\nlog_level = \"debug\"\n",
+		filepath.Join(dir, "ldap.conf"): "include = [\"wg-logger.conf\"]\n[peer_directory_ldap]\nurl = \"ldap://localhost\"\n",
+		conf + ".d/20-interval.conf":    "interval = 30\n",
+		conf + ".d/10-interval.conf":    "interval = 20\nlog_level = \"warn\"\n",
+		conf + ".d/README":              "not loaded",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := GetConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	includeTests := []struct {
+		Name   string
+		Want   interface{}
+		Out    interface{}
+		Source Source
+	}{
+		{"interval", int64(30), config.Interval, Source("file:" + conf + ".d/20-interval.conf")},
+		{"log_level", "warn", config.LogLevel, Source("file:" + conf + ".d/10-interval.conf")},
+		{"peer_directory_ldap.url", "ldap://localhost", config.PeerDirectoryLDAP.URL, Source("file:" + filepath.Join(dir, "ldap.conf"))},
+		{"peer_directory_ldap.timeout", int64(10), config.PeerDirectoryLDAP.Timeout, SourceDefault},
+	}
+	for _, tt := range includeTests {
+		if tt.Out != tt.Want {
+			t.Errorf("%s: \n out:  %#v\n want: %#v", tt.Name, tt.Out, tt.Want)
+		}
+		if out := config.Source(tt.Name); out != tt.Source {
+			t.Errorf("%s: \n out:  %s\n want: %s", tt.Name, out, tt.Source)
+		}
+	}
+
+	if err = os.WriteFile(conf, []byte("include = [\"missing.conf\"]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	want := conf + ": included file '" + filepath.Join(dir, "missing.conf") + "' is not found"
+	if _, err = GetConfig(conf); err == nil || err.Error() != want {
+		t.Errorf("\n out:  %v\n want: %s", err, want)
+	}
+}
+
+func Test_GetConfig_Sinks(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "wg-logger.conf")
+	files := map[string]string{
+		conf:                         "[[sink]]\ntype = \"File\"\npath = \"/var/log/wg-logger/all.log\"\n",
+		conf + ".d/10-security.conf": "[[sink]]\nname = \"security\"\ntype = \"syslog\"\nevents = [\"endpoint_ip updated\"]\nlevel = \"WARN\"\n",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := GetConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SinkConfig{
+		{Name: "file", Type: "file", Stream: "event", Level: "info", Format: "json", Path: "/var/log/wg-logger/all.log", Facility: "local0", Tag: "wg-logger", Timeout: 10, OutboxMax: 100000},
+		{Name: "security", Type: "syslog", Stream: "event", Events: []string{"endpoint_ip updated"}, Level: "warn", Format: "json", Facility: "local0", Tag: "wg-logger", Timeout: 10, OutboxMax: 100000},
+	}
+	if !reflect.DeepEqual(config.Sinks, want) {
+		t.Errorf("\n out:  %#v\n want: %#v", config.Sinks, want)
+	}
+	if out := config.Source("sink.1"); out != Source("file:"+conf+".d/10-security.conf") {
+		t.Errorf("sink.1: \n out:  %s", out)
+	}
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source is where the value of a config parameter comes from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	// SourceFile is followed by the path, e.g. 'file:/etc/wg-logger.conf.d/10-ldap.conf'
+	SourceFile Source = "file"
+	SourceEnv  Source = "env"
+	SourceFlag Source = "flag"
+)
+
+// EnvPrefix is the prefix of environment variables overriding config parameters,
+// e.g. WG_LOGGER_INTERVAL, WG_LOGGER_PEER_DIRECTORY_LDAP_URL
+const EnvPrefix = "WG_LOGGER_"
+
+// EnvName returns the environment variable name for the config key.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+// param is a config parameter with the key in TOML, e.g. 'peer_directory_ldap.url'
+type param struct {
+	key   string
+	table string
+	value reflect.Value
+}
+
+// params returns all parameters of the config in the order of fields.
+func (c *Config) params() (params []param) {
+	var walk func(v reflect.Value, table string)
+	walk = func(v reflect.Value, table string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := t.Field(i).Tag.Get("toml")
+			if name == "" || name == "-" {
+				continue
+			}
+			key := name
+			if table != "" {
+				key = table + "." + name
+			}
+			switch v.Field(i).Kind() {
+			case reflect.Struct:
+				walk(v.Field(i), key)
+				continue
+			case reflect.Slice:
+				// arrays of tables are not single parameters
+				if table == "" && v.Field(i).Type().Elem().Kind() == reflect.Struct {
+					continue
+				}
+			}
+			params = append(params, param{key: key, table: table, value: v.Field(i)})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return
+}
+
+// Source returns where the value of the config key comes from.
+func (c *Config) Source(key string) Source {
+	if s, ok := c.Sources[key]; ok {
+		return s
+	}
+	return SourceDefault
+}
+
+func (c *Config) setSource(key string, source Source) {
+	if c.Sources == nil {
+		c.Sources = make(map[string]Source)
+	}
+	c.Sources[key] = source
+}
+
+// Set parses the value for the config key and records its source.
+func (c *Config) Set(key string, value string, source Source) error {
+	for _, p := range c.params() {
+		if p.key != key {
+			continue
+		}
+		switch p.value.Kind() {
+		case reflect.String:
+			if enumKeys[key] {
+				value = strings.ToLower(value)
+			}
+			p.value.SetString(value)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: '%s' is not an integer", key, value)
+			}
+			p.value.SetInt(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s: '%s' is not a boolean", key, value)
+			}
+			p.value.SetBool(b)
+		default:
+			return fmt.Errorf("%s: unsupported type %s", key, p.value.Type())
+		}
+		c.setSource(key, source)
+		return nil
+	}
+	return fmt.Errorf("unknown key '%s'", key)
+}
+
+// ApplyEnv overrides parameters with WG_LOGGER_* environment variables.
+// lookup is usually os.LookupEnv.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, p := range c.params() {
+		value, ok := lookup(EnvName(p.key))
+		if !ok {
+			continue
+		}
+		if err := c.Set(p.key, value, SourceEnv); err != nil {
+			return fmt.Errorf("environment variable %s: %w", EnvName(p.key), err)
+		}
+	}
+	return nil
+}
+
+// enumKeys are parameters chosen from lower-case words.
+// Their values are lower-cased when they are set, so consumers can compare them as is.
+var enumKeys = map[string]bool{
+	"log_rotate":                true,
+	"log_level":                 true,
+	"log_output":                true,
+	"event_log_format":          true,
+	"database_driver":           true,
+	"peer_directory_precedence": true,
+	"peer_directory_provider":   true,
+}
+
+// lowerEnums lower-cases values of enumKeys.
+func (c *Config) lowerEnums() {
+	for _, p := range c.params() {
+		if enumKeys[p.key] {
+			p.value.SetString(strings.ToLower(p.value.String()))
+		}
+	}
+}
+
+// secretKeys are parameters hidden in Dump
+var secretKeys = map[string]bool{
+	"peer_directory_ldap.bind_password": true,
+	"peer_directory_http.bearer_token":  true,
+}
+
+// Dump writes parameters as TOML, with the source of each value as comment.
+// Secrets are replaced with "(hidden)" unless they are empty.
+func (c *Config) Dump(w io.Writer) error {
+	// keys after a table header belong to the table, so top-level keys are written first
+	params := c.params()
+	sort.SliceStable(params, func(i, j int) bool {
+		return params[i].table == "" && params[j].table != ""
+	})
+	table := ""
+	for _, p := range params {
+		if p.table != table {
+			table = p.table
+			if _, err := fmt.Fprintf(w, "\n[%s]\n", table); err != nil {
+				return err
+			}
+		}
+		value := tomlValue(p.value)
+		if secretKeys[p.key] && p.value.String() != "" {
+			value = strconv.Quote("(hidden)")
+		}
+		name := p.key[strings.LastIndex(p.key, ".")+1:]
+		if _, err := fmt.Fprintf(w, "%s = %s # %s\n", name, value, c.Source(p.key)); err != nil {
+			return err
+		}
+	}
+
+	for i, sink := range c.Sinks {
+		if _, err := fmt.Fprintf(w, "\n[[sink]] # %s\n", c.Source(fmt.Sprintf("sink.%d", i))); err != nil {
+			return err
+		}
+		v := reflect.ValueOf(sink)
+		for j := 0; j < v.NumField(); j++ {
+			if _, err := fmt.Fprintf(w, "%s = %s\n", v.Type().Field(j).Tag.Get("toml"), tomlValue(v.Field(j))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tomlValue formats strings, integers, booleans and arrays of them in TOML.
+func tomlValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Slice:
+		values := make([]string, v.Len())
+		for i := range values {
+			values[i] = tomlValue(v.Index(i))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
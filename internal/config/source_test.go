@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func Test_EnvName(t *testing.T) {
+	for key, want := range map[string]string{
+		"log_max_mb":                        "WG_LOGGER_LOG_MAX_MB",
+		"peer_directory_ldap.bind_password": "WG_LOGGER_PEER_DIRECTORY_LDAP_BIND_PASSWORD",
+	} {
+		if out := EnvName(key); out != want {
+			t.Errorf("%s: \n out:  %s\n want: %s", key, out, want)
+		}
+	}
+}
+
+func Test_ApplyEnv(t *testing.T) {
+	config, err := GetConfig("../../configs/sample.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{
+		"WG_LOGGER_EVENT_LOG_PATH":              "/dev/stdout",
+		"WG_LOGGER_LOG_MAX_DAYS":                "14",
+		"WG_LOGGER_PEER_DIRECTORY_HTTP_TIMEOUT": "3",
+		"WG_LOGGER_UNKNOWN":                     "ignored",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	if err = config.ApplyEnv(lookup); err != nil {
+		t.Fatal(err)
+	}
+	// flags take precedence over env
+	if err = config.Set("log_max_days", "30", SourceFlag); err != nil {
+		t.Fatal(err)
+	}
+
+	sourceTests := []struct {
+		Key   string
+		Want  Source
+		Value interface{}
+		Out   interface{}
+	}{
+		{"event_log_path", SourceEnv, "/dev/stdout", config.EventLogPath},
+		{"log_max_days", SourceFlag, 30, config.LogMaxDays},
+		{"peer_directory_http.timeout", SourceEnv, int64(3), config.PeerDirectoryHTTP.Timeout},
+		{"peer_directory_ldap.timeout", SourceDefault, int64(10), config.PeerDirectoryLDAP.Timeout},
+		{"interval", Source("file:../../configs/sample.conf"), int64(10), config.Interval},
+	}
+	for _, tt := range sourceTests {
+		if out := config.Source(tt.Key); out != tt.Want {
+			t.Errorf("%s: \n out:  %s\n want: %s", tt.Key, out, tt.Want)
+		}
+		if tt.Out != tt.Value {
+			t.Errorf("%s: \n out:  %#v\n want: %#v", tt.Key, tt.Out, tt.Value)
+		}
+	}
+
+	env = map[string]string{"WG_LOGGER_INTERVAL": "ten"}
+	want := "environment variable WG_LOGGER_INTERVAL: interval: 'ten' is not an integer"
+	if err = config.ApplyEnv(lookup); err == nil || err.Error() != want {
+		t.Errorf("\n out:  %v\n want: %s", err, want)
+	}
+}
+
+func Test_Dump_TOML(t *testing.T) {
+	config, err := GetConfig("../../configs/sample.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := SinkDefault()
+	sink.Name, sink.Type, sink.URL = "webhook", "webhook", "https://example.com/logs"
+	sink.Events = []string{"endpoint_ip updated", "suspected inactive"}
+	config.Sinks = append(config.Sinks, sink)
+	var buf bytes.Buffer
+	if err := config.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var dumped Config
+	md, err := toml.Decode(buf.String(), &dumped)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		t.Errorf("unknown keys %v", undecoded)
+	}
+	if dumped.Database != config.Database || dumped.Interval != config.Interval || dumped.Messages != config.Messages {
+		t.Errorf("\n out:  %#v\n want: %#v", dumped, config)
+	}
+	if !reflect.DeepEqual(dumped.Sinks, config.Sinks) {
+		t.Errorf("\n out:  %#v\n want: %#v", dumped.Sinks, config.Sinks)
+	}
+}
+
+func Test_Set_Enum(t *testing.T) {
+	config := GetDefault()
+	for key, value := range map[string]string{"database_driver": "SQLite", "log_level": "DEBUG"} {
+		if err := config.Set(key, value, SourceFlag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if config.DatabaseDriver != "sqlite" || config.LogLevel != "debug" {
+		t.Errorf("not lower-cased: %s, %s", config.DatabaseDriver, config.LogLevel)
+	}
+	// other strings are kept as is
+	if err := config.Set("wg_conf", "/etc/WireGuard/wg0.conf", SourceFlag); err != nil {
+		t.Fatal(err)
+	}
+	if config.WGConf != "/etc/WireGuard/wg0.conf" {
+		t.Errorf("wg_conf: %s", config.WGConf)
+	}
+}
+
+func Test_Dump(t *testing.T) {
+	config := GetDefault()
+	if err := config.Set("interval", "5", SourceEnv); err != nil {
+		t.Fatal(err)
+	}
+	config.PeerDirectoryLDAP.BindPassword = "secret"
+	var buf bytes.Buffer
+	if err := config.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"event_log_path = \"/var/log/wg-logger/wg.log\" # default\n",
+		"interval = 5 # env\n",
+		"\n[peer_directory_ldap]\nurl = \"\" # default\n",
+		"bind_password = \"(hidden)\" # default\n",
+		"\n[peer_directory_http]\nurl = \"\" # default\nbearer_token = \"\" # default\ntimeout = 10 # default\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("\n out:  %s\n want: %s", buf.String(), want)
+		}
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("secret is dumped: %s", buf.String())
+	}
+}
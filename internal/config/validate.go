@@ -0,0 +1,239 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// Validate checks ranges of parameters and existence of paths.
+// It returns problems as '<key>: <reason>', or nil when the config is valid.
+func (c *Config) Validate() (problems []string) {
+	add := func(key string, format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s: %s", key, fmt.Sprintf(format, a...)))
+	}
+	oneOf := func(key string, value string, choices ...string) {
+		for _, choice := range choices {
+			if strings.EqualFold(value, choice) {
+				return
+			}
+		}
+		add(key, "'%s' is invalid, choose from %s", value, strings.Join(choices, ", "))
+	}
+	// logs and database are created when they do not exist
+	writableFile := func(key string, path string) {
+		if path == "" {
+			add(key, "must not be empty")
+			return
+		}
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			add(key, "'%s' is a directory", path)
+		}
+	}
+	existingFile := func(key string, path string) {
+		fi, err := os.Stat(path)
+		switch {
+		case path == "":
+			add(key, "must not be empty")
+		case err != nil:
+			add(key, "%v", err)
+		case fi.IsDir():
+			add(key, "'%s' is a directory", path)
+		}
+	}
+	serverURL := func(key string, rawURL string, schemes ...string) {
+		if rawURL == "" {
+			add(key, "must not be empty")
+			return
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			add(key, "%v", err)
+			return
+		}
+		oneOf(key+" scheme", u.Scheme, schemes...)
+		if u.Host == "" {
+			add(key, "'%s' has no host", rawURL)
+		}
+	}
+
+	writableFile("event_log_path", c.EventLogPath)
+	writableFile("daemon_log_path", c.DaemonLogPath)
+	if c.LogMaxMB <= 0 {
+		add("log_max_mb", "must be greater than 0, got %d", c.LogMaxMB)
+	}
+	if c.LogMaxDays < 0 {
+		add("log_max_days", "must be 0 (keep all) or greater, got %d", c.LogMaxDays)
+	}
+	oneOf("log_rotate", c.LogRotate, "size", "daily", "hourly")
+	if c.LogMaxBackups < 0 {
+		add("log_max_backups", "must be 0 (keep all) or greater, got %d", c.LogMaxBackups)
+	}
+	if _, err := ParseFileMode(c.LogFileMode); err != nil {
+		add("log_file_mode", "%v", err)
+	}
+	if _, _, err := ParseOwner(c.LogFileOwner); err != nil {
+		add("log_file_owner", "%v", err)
+	}
+	oneOf("log_level", c.LogLevel, "error", "warn", "info", "debug")
+	oneOf("log_output", c.LogOutput, "console", "file", "json", "none")
+	oneOf("event_log_format", c.EventLogFormat, "json", "logfmt", "cef", "leef")
+	if c.EventLogHashKeyFile != "" {
+		existingFile("event_log_hash_key_file", c.EventLogHashKeyFile)
+		if !strings.EqualFold(c.LogOutput, "file") {
+			add("event_log_hash_key_file", "is used with log_output 'file' only, got '%s'", c.LogOutput)
+		}
+		if !strings.EqualFold(c.EventLogFormat, "json") {
+			add("event_log_hash_key_file", "is used with event_log_format 'json' only, got '%s'", c.EventLogFormat)
+		}
+	}
+
+	existingFile("wg_conf", c.WGConf)
+	writableFile("database", c.Database)
+	oneOf("database_driver", c.DatabaseDriver, "bbolt", "sqlite")
+	if c.HistoryMaxDays < 0 {
+		add("history_max_days", "must be 0 (keep all) or greater, got %d", c.HistoryMaxDays)
+	}
+	if c.Interval <= 0 {
+		add("interval", "must be greater than 0, got %d", c.Interval)
+	}
+	if c.SuspectedInactiveThreshold <= 0 {
+		add("suspected_inactive_threshold", "must be greater than 0, got %d", c.SuspectedInactiveThreshold)
+	}
+	if c.WGToolsPath == "" {
+		add("wg_tools_path", "must not be empty")
+	} else if _, err := exec.LookPath(c.WGToolsPath); err != nil {
+		add("wg_tools_path", "%v", err)
+	}
+	// dump directory is created when it does not exist
+	if c.DumpDir != "" {
+		if fi, err := os.Stat(c.DumpDir); err == nil && !fi.IsDir() {
+			add("dump_dir", "'%s' is not a directory", c.DumpDir)
+		}
+	}
+	if c.DumpEvery <= 0 {
+		add("dump_every", "must be greater than 0, got %d", c.DumpEvery)
+	}
+	if c.DumpMaxDays < 0 {
+		add("dump_max_days", "must be 0 (keep all) or greater, got %d", c.DumpMaxDays)
+	}
+
+	oneOf("peer_directory_precedence", c.PeerDirectoryPrecedence, "wgconf", "directory")
+	oneOf("peer_directory_provider", c.PeerDirectoryProvider, "file", "ldap", "http")
+	if c.PeerDirectoryCacheTTL < 0 {
+		add("peer_directory_cache_ttl", "must be 0 (no cache) or greater, got %d", c.PeerDirectoryCacheTTL)
+	}
+	switch strings.ToLower(c.PeerDirectoryProvider) {
+	case "file":
+		// empty path disables peer directory
+		if c.PeerDirectory != "" {
+			existingFile("peer_directory", c.PeerDirectory)
+		}
+	case "ldap":
+		l := c.PeerDirectoryLDAP
+		serverURL("peer_directory_ldap.url", l.URL, "ldap", "ldaps")
+		if l.PublicKeyAttribute == "" {
+			add("peer_directory_ldap.public_key_attribute", "must not be empty")
+		}
+		if l.Timeout <= 0 {
+			add("peer_directory_ldap.timeout", "must be greater than 0, got %d", l.Timeout)
+		}
+	case "http":
+		h := c.PeerDirectoryHTTP
+		serverURL("peer_directory_http.url", h.URL, "http", "https")
+		if h.Timeout <= 0 {
+			add("peer_directory_http.timeout", "must be greater than 0, got %d", h.Timeout)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, sink := range c.Sinks {
+		key := fmt.Sprintf("sink[%d]", i)
+		oneOf(key+".type", sink.Type, "file", "stdout", "stderr", "syslog", "webhook", "fluent", "gelf")
+		oneOf(key+".stream", sink.Stream, "event", "daemon")
+		oneOf(key+".level", sink.Level, "error", "warn", "info", "debug")
+		oneOf(key+".format", sink.Format, "json", "console", "logfmt", "cef", "leef")
+		switch strings.ToLower(sink.Type) {
+		case "file":
+			writableFile(key+".path", sink.Path)
+		case "syslog":
+			if sink.Address != "" {
+				serverURL(key+".address", sink.Address, "udp", "tcp")
+			}
+			oneOf(key+".facility", sink.Facility,
+				"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp",
+				"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7")
+		case "webhook":
+			serverURL(key+".url", sink.URL, "http", "https")
+		case "fluent":
+			if !strings.HasPrefix(sink.Address, "unix://") {
+				serverURL(key+".address", sink.Address, "tcp", "unix")
+			}
+		case "gelf":
+			serverURL(key+".address", sink.Address, "udp", "tcp")
+		}
+		switch strings.ToLower(sink.Type) {
+		case "fluent", "gelf":
+			// records are converted from JSON logs
+			if !strings.EqualFold(sink.Format, "json") {
+				add(key+".format", "'%s' is invalid for %s sink, use json", sink.Format, sink.Type)
+			}
+		}
+		if sink.IsRemote() {
+			if sink.Timeout <= 0 {
+				add(key+".timeout", "must be greater than 0, got %d", sink.Timeout)
+			}
+			if sink.OutboxMax <= 0 {
+				add(key+".outbox_max", "must be greater than 0, got %d", sink.OutboxMax)
+			}
+		}
+		if names[sink.Name] {
+			add(key+".name", "'%s' is already used, names must be unique", sink.Name)
+		}
+		names[sink.Name] = true
+	}
+
+	return problems
+}
+
+// ParseFileMode parses the permission in octal, e.g. '0640'.
+func ParseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("'%s' is invalid, use octal permission like '0640'", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// ParseOwner parses 'user', 'user:group' or ':group' into ids for os.Chown.
+// Names and numeric ids are accepted, and -1 means unchanged.
+func ParseOwner(s string) (uid int, gid int, err error) {
+	uid, gid = -1, -1
+	if s == "" {
+		return
+	}
+	name, group, hasGroup := strings.Cut(s, ":")
+	if name != "" {
+		if uid, err = strconv.Atoi(name); err != nil {
+			u, e := user.Lookup(name)
+			if e != nil {
+				return -1, -1, e
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if hasGroup && group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, e := user.LookupGroup(group)
+			if e != nil {
+				return -1, -1, e
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func validConfig(t *testing.T) *Config {
+	dir := t.TempDir()
+	config := GetDefault()
+	config.EventLogPath = filepath.Join(dir, "wg.log")
+	config.DaemonLogPath = filepath.Join(dir, "wg-logger.log")
+	config.Database = filepath.Join(dir, "wg-logger.db")
+	config.WGConf = "../../test/wg0.conf"
+	config.WGToolsPath = os.Args[0]
+	return config
+}
+
+func Test_Validate(t *testing.T) {
+	validateTests := []struct {
+		Name   string
+		Modify func(c *Config)
+		Want   []string
+	}{
+		{"default", func(c *Config) {}, nil},
+		{"case insensitive", func(c *Config) { c.LogLevel = "DEBUG" }, nil},
+		{"ranges", func(c *Config) {
+			c.Interval = 0
+			c.SuspectedInactiveThreshold = -1
+			c.LogMaxMB = 0
+			c.LogMaxDays = -1
+			c.PeerDirectoryCacheTTL = -1
+			c.HistoryMaxDays = -1
+		}, []string{
+			"log_max_mb: must be greater than 0, got 0",
+			"log_max_days: must be 0 (keep all) or greater, got -1",
+			"history_max_days: must be 0 (keep all) or greater, got -1",
+			"interval: must be greater than 0, got 0",
+			"suspected_inactive_threshold: must be greater than 0, got -1",
+			"peer_directory_cache_ttl: must be 0 (no cache) or greater, got -1",
+		}},
+		{"choices", func(c *Config) {
+			c.LogLevel = "trace"
+			c.LogOutput = "syslog"
+			c.EventLogFormat = "xml"
+			c.DatabaseDriver = "mysql"
+			c.PeerDirectoryPrecedence = "ldap"
+			c.PeerDirectoryProvider = "dns"
+		}, []string{
+			"log_level: 'trace' is invalid, choose from error, warn, info, debug",
+			"log_output: 'syslog' is invalid, choose from console, file, json, none",
+			"event_log_format: 'xml' is invalid, choose from json, logfmt, cef, leef",
+			"database_driver: 'mysql' is invalid, choose from bbolt, sqlite",
+			"peer_directory_precedence: 'ldap' is invalid, choose from wgconf, directory",
+			"peer_directory_provider: 'dns' is invalid, choose from file, ldap, http",
+		}},
+		{"paths", func(c *Config) {
+			c.EventLogPath = ""
+			c.Database = "../../test"
+			c.WGConf = "../../test/not-found.conf"
+			c.WGToolsPath = ""
+			c.PeerDirectory = "../../test"
+		}, []string{
+			"event_log_path: must not be empty",
+			"wg_conf: stat ../../test/not-found.conf: no such file or directory",
+			"database: '../../test' is a directory",
+			"wg_tools_path: must not be empty",
+			"peer_directory: '../../test' is a directory",
+		}},
+		{"rotation", func(c *Config) {
+			c.LogRotate = "weekly"
+			c.LogMaxBackups = -1
+			c.LogFileMode = "0999"
+			c.LogFileOwner = "root:no-such-group-wg-logger"
+		}, []string{
+			"log_rotate: 'weekly' is invalid, choose from size, daily, hourly",
+			"log_max_backups: must be 0 (keep all) or greater, got -1",
+			"log_file_mode: '0999' is invalid, use octal permission like '0640'",
+			"log_file_owner: group: unknown group no-such-group-wg-logger",
+		}},
+		{"dump", func(c *Config) {
+			c.DumpDir = "../../test/wg0.conf"
+			c.DumpEvery = 0
+			c.DumpMaxDays = -1
+		}, []string{
+			"dump_dir: '../../test/wg0.conf' is not a directory",
+			"dump_every: must be greater than 0, got 0",
+			"dump_max_days: must be 0 (keep all) or greater, got -1",
+		}},
+		{"hash key", func(c *Config) {
+			c.LogOutput = "json"
+			c.EventLogFormat = "cef"
+			c.EventLogHashKeyFile = "../../test/not-found.key"
+		}, []string{
+			"event_log_hash_key_file: stat ../../test/not-found.key: no such file or directory",
+			"event_log_hash_key_file: is used with log_output 'file' only, got 'json'",
+			"event_log_hash_key_file: is used with event_log_format 'json' only, got 'cef'",
+		}},
+		{"ldap", func(c *Config) {
+			c.PeerDirectoryProvider = "ldap"
+			c.PeerDirectoryLDAP.URL = "https://ldap.example.com"
+			c.PeerDirectoryLDAP.PublicKeyAttribute = ""
+			c.PeerDirectoryLDAP.Timeout = 0
+		}, []string{
+			"peer_directory_ldap.url scheme: 'https' is invalid, choose from ldap, ldaps",
+			"peer_directory_ldap.public_key_attribute: must not be empty",
+			"peer_directory_ldap.timeout: must be greater than 0, got 0",
+		}},
+		{"sinks", func(c *Config) {
+			c.Sinks = []SinkConfig{SinkDefault(), SinkDefault(), SinkDefault(), SinkDefault(), SinkDefault(), SinkDefault()}
+			c.Sinks[0].Type, c.Sinks[0].Name = "file", "file"
+			c.Sinks[1].Type, c.Sinks[1].Name = "webhook", "webhook"
+			c.Sinks[1].URL = "ftp://example.com"
+			c.Sinks[2].Type, c.Sinks[2].Name = "syslog", "syslog"
+			c.Sinks[2].Stream = "access"
+			c.Sinks[2].Facility = "local8"
+			c.Sinks[3].Type, c.Sinks[3].Name = "fluent", "fluent"
+			c.Sinks[3].Address = "unix:///var/run/fluent.sock"
+			c.Sinks[3].OutboxMax = 0
+			c.Sinks[4].Type, c.Sinks[4].Name = "gelf", "fluent"
+			c.Sinks[4].Address = "http://graylog:12201"
+			c.Sinks[5].Type, c.Sinks[5].Name = "gelf", "gelf"
+			c.Sinks[5].Address = "tcp://graylog:12201"
+			c.Sinks[5].Format = "cef"
+		}, []string{
+			"sink[0].path: must not be empty",
+			"sink[1].url scheme: 'ftp' is invalid, choose from http, https",
+			"sink[2].stream: 'access' is invalid, choose from event, daemon",
+			"sink[2].facility: 'local8' is invalid, choose from kern, user, mail, daemon, auth, syslog, lpr, news, uucp, cron, authpriv, ftp, local0, local1, local2, local3, local4, local5, local6, local7",
+			"sink[3].outbox_max: must be greater than 0, got 0",
+			"sink[4].address scheme: 'http' is invalid, choose from udp, tcp",
+			"sink[4].name: 'fluent' is already used, names must be unique",
+			"sink[5].format: 'cef' is invalid for gelf sink, use json",
+		}},
+		{"http", func(c *Config) {
+			c.PeerDirectoryProvider = "http"
+			c.PeerDirectoryHTTP.URL = "https:///peers"
+		}, []string{
+			"peer_directory_http.url: 'https:///peers' has no host",
+		}},
+	}
+
+	for _, tt := range validateTests {
+		config := validConfig(t)
+		tt.Modify(config)
+		if out := config.Validate(); !reflect.DeepEqual(out, tt.Want) {
+			t.Errorf("%s: \n out:  %#v\n want: %#v", tt.Name, out, tt.Want)
+		}
+	}
+}
+
+func Test_ParseOwner(t *testing.T) {
+	ownerTests := []struct {
+		Owner    string
+		UID, GID int
+	}{
+		{"", -1, -1},
+		{"root", 0, -1},
+		{"root:0", 0, 0},
+		{":0", -1, 0},
+		{"1000:1000", 1000, 1000},
+	}
+	for _, tt := range ownerTests {
+		uid, gid, err := ParseOwner(tt.Owner)
+		if err != nil || uid != tt.UID || gid != tt.GID {
+			t.Errorf("%s: \n out:  %d, %d, %v\n want: %d, %d", tt.Owner, uid, gid, err, tt.UID, tt.GID)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package detect finds events of peers from changes of 'wg show all dump'.
+// It has no I/O, the caller keeps State of each peer between checks and handles events.
+package detect
+
+import (
+	"strings"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/pkg/event"
+)
+
+// State is the status of a peer kept between checks, which is the peer of events.
+type State = event.Peer
+
+// Initial returns the state of a peer which is seen for the first time.
+func Initial() State {
+	return State{
+		PeerStat: event.PeerStat{
+			LatestHandshake: time.Unix(0, 0),
+		},
+	}
+}
+
+// Detector detects events of a peer.
+type Detector struct {
+	// SuspectedInactiveThreshold is the time without handshake and transfer to detect 'suspected inactive'
+	SuspectedInactiveThreshold time.Duration
+}
+
+// Rotated reports whether transfer counters are smaller than the previous ones,
+// e.g. the interface was recreated. The current values are used as transferred bytes then.
+func Rotated(prev State, stat event.PeerStat) (rx bool, tx bool) {
+	return stat.TransferRX < prev.TransferRX, stat.TransferTX < prev.TransferTX
+}
+
+// EndpointIP returns the IP address part of the endpoint, '(none)' when the endpoint is unknown.
+// IPv6 addresses are kept bracketed, e.g. '[2001:db8::1]'.
+func EndpointIP(endpoint string) string {
+	if i := strings.LastIndex(endpoint, ":"); i > 0 {
+		return endpoint[0:i]
+	}
+	return "(none)"
+}
+
+// Detect returns the new state of the peer and events found at now.
+// FriendlyName, Labels and Message of events are left for the caller.
+//
+//   - endpoint_ip updated: the IP address of the endpoint changed, after 'statistics' of the last endpoint
+//   - endpoint updated: the port of the endpoint changed, after 'statistics' of the last endpoint
+//   - handshake: the latest handshake changed
+//   - suspected inactive: no handshake and transfer for SuspectedInactiveThreshold, once until it changes
+func (d Detector) Detect(prev State, stat event.PeerStat, now time.Time) (State, []event.Event) {
+	transferredRX := stat.TransferRX - prev.TransferRX
+	transferredTX := stat.TransferTX - prev.TransferTX
+	rotatedRX, rotatedTX := Rotated(prev, stat)
+	if rotatedRX {
+		transferredRX = stat.TransferRX
+	}
+	if rotatedTX {
+		transferredTX = stat.TransferTX
+	}
+
+	cur := State{
+		PeerStat:                   stat,
+		EndpointIP:                 EndpointIP(stat.Endpoint),
+		TransferredRXPerEndpoint:   prev.TransferredRXPerEndpoint + transferredRX,
+		TransferredTXPerEndpoint:   prev.TransferredTXPerEndpoint + transferredTX,
+		TransferredRXPerEndpointIP: prev.TransferredRXPerEndpointIP + transferredRX,
+		TransferredTXPerEndpointIP: prev.TransferredTXPerEndpointIP + transferredTX,
+	}
+	newEvent := func(t event.Type, peer State) event.Event {
+		return event.Event{Type: t, Time: cur.LatestHandshake, Peer: peer}
+	}
+	// final statistics of the last endpoint
+	final := func() event.Event {
+		finalState := cur
+		finalState.Endpoint = prev.Endpoint
+		finalState.EndpointIP = prev.EndpointIP
+		finalState.LatestHandshake = prev.LatestHandshake
+		return newEvent(event.Statistics, finalState)
+	}
+
+	var events []event.Event
+	switch {
+	case cur.EndpointIP != prev.EndpointIP:
+		events = append(events, final())
+		cur.TransferredRXPerEndpoint = 0
+		cur.TransferredTXPerEndpoint = 0
+		cur.TransferredRXPerEndpointIP = 0
+		cur.TransferredTXPerEndpointIP = 0
+		cur.SuspectedInactive = false
+		events = append(events, newEvent(event.EndpointIPUpdated, cur))
+	case cur.Endpoint != prev.Endpoint:
+		events = append(events, final())
+		cur.TransferredRXPerEndpoint = 0
+		cur.TransferredTXPerEndpoint = 0
+		cur.SuspectedInactive = false
+		events = append(events, newEvent(event.EndpointUpdated, cur))
+	case !cur.LatestHandshake.Equal(prev.LatestHandshake):
+		events = append(events, newEvent(event.Handshake, cur))
+	case !cur.LatestHandshake.Equal(time.Unix(0, 0)) &&
+		now.Sub(cur.LatestHandshake) > d.SuspectedInactiveThreshold &&
+		cur.TransferRX == prev.TransferRX &&
+		cur.TransferTX == prev.TransferTX:
+		if !prev.SuspectedInactive {
+			e := newEvent(event.SuspectedInactive, cur)
+			e.InactiveMinutes = int64(now.Sub(cur.LatestHandshake).Minutes())
+			events = append(events, e)
+		}
+		cur.SuspectedInactive = true
+	}
+	return cur, events
+}
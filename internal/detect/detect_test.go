@@ -0,0 +1,204 @@
+package detect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/pkg/event"
+	"github.com/stretchr/testify/assert"
+)
+
+const publicKey = "i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA="
+
+var (
+	handshake = time.Unix(1599229650, 0)
+	now       = handshake.Add(time.Minute)
+)
+
+func peerStat(endpoint string, latestHandshake time.Time, rx uint64, tx uint64) event.PeerStat {
+	return event.PeerStat{
+		PublicKey:       publicKey,
+		Endpoint:        endpoint,
+		LatestHandshake: latestHandshake,
+		TransferRX:      rx,
+		TransferTX:      tx,
+	}
+}
+
+func state(stat event.PeerStat, rxEndpoint, txEndpoint, rxEndpointIP, txEndpointIP uint64, inactive bool) State {
+	return State{
+		PeerStat:                   stat,
+		EndpointIP:                 EndpointIP(stat.Endpoint),
+		TransferredRXPerEndpoint:   rxEndpoint,
+		TransferredTXPerEndpoint:   txEndpoint,
+		TransferredRXPerEndpointIP: rxEndpointIP,
+		TransferredTXPerEndpointIP: txEndpointIP,
+		SuspectedInactive:          inactive,
+	}
+}
+
+func TestDetector_Detect(t *testing.T) {
+	detector := Detector{SuspectedInactiveThreshold: 30 * time.Minute}
+	last := peerStat("192.0.2.1:51820", handshake, 1000, 2000)
+	lastState := state(last, 300, 400, 500, 600, false)
+
+	detectTests := []struct {
+		Name   string
+		Prev   State
+		Stat   event.PeerStat
+		Now    time.Time
+		State  State
+		Events []event.Event
+	}{
+		{
+			Name: "first observation",
+			Prev: Initial(),
+			Stat: last,
+			Now:  now,
+			// transferred bytes before wg-logger started are not counted per endpoint
+			State: state(last, 0, 0, 0, 0, false),
+			Events: []event.Event{
+				{Type: event.Statistics, Time: handshake, Peer: State{
+					PeerStat:                   event.PeerStat{PublicKey: publicKey, LatestHandshake: time.Unix(0, 0), TransferRX: 1000, TransferTX: 2000},
+					TransferredRXPerEndpoint:   1000,
+					TransferredTXPerEndpoint:   2000,
+					TransferredRXPerEndpointIP: 1000,
+					TransferredTXPerEndpointIP: 2000,
+				}},
+				{Type: event.EndpointIPUpdated, Time: handshake, Peer: state(last, 0, 0, 0, 0, false)},
+			},
+		},
+		{
+			Name:   "no change",
+			Prev:   lastState,
+			Stat:   last,
+			Now:    now,
+			State:  lastState,
+			Events: nil,
+		},
+		{
+			Name:  "transfer without handshake",
+			Prev:  lastState,
+			Stat:  peerStat("192.0.2.1:51820", handshake, 1100, 2200),
+			Now:   now,
+			State: state(peerStat("192.0.2.1:51820", handshake, 1100, 2200), 400, 600, 600, 800, false),
+		},
+		{
+			Name:  "endpoint ip change",
+			Prev:  lastState,
+			Stat:  peerStat("198.51.100.1:51820", handshake.Add(time.Minute), 1100, 2200),
+			Now:   now,
+			State: state(peerStat("198.51.100.1:51820", handshake.Add(time.Minute), 1100, 2200), 0, 0, 0, 0, false),
+			Events: []event.Event{
+				{Type: event.Statistics, Time: handshake.Add(time.Minute), Peer: state(peerStat("192.0.2.1:51820", handshake, 1100, 2200), 400, 600, 600, 800, false)},
+				{Type: event.EndpointIPUpdated, Time: handshake.Add(time.Minute), Peer: state(peerStat("198.51.100.1:51820", handshake.Add(time.Minute), 1100, 2200), 0, 0, 0, 0, false)},
+			},
+		},
+		{
+			Name: "port change",
+			Prev: lastState,
+			Stat: peerStat("192.0.2.1:51821", handshake.Add(time.Minute), 1100, 2200),
+			Now:  now,
+			// transferred bytes per endpoint ip are kept
+			State: state(peerStat("192.0.2.1:51821", handshake.Add(time.Minute), 1100, 2200), 0, 0, 600, 800, false),
+			Events: []event.Event{
+				{Type: event.Statistics, Time: handshake.Add(time.Minute), Peer: state(peerStat("192.0.2.1:51820", handshake, 1100, 2200), 400, 600, 600, 800, false)},
+				{Type: event.EndpointUpdated, Time: handshake.Add(time.Minute), Peer: state(peerStat("192.0.2.1:51821", handshake.Add(time.Minute), 1100, 2200), 0, 0, 600, 800, false)},
+			},
+		},
+		{
+			Name:  "ipv6 endpoint port change",
+			Prev:  state(peerStat("[2001:db8::1]:51820", handshake, 1000, 2000), 0, 0, 0, 0, false),
+			Stat:  peerStat("[2001:db8::1]:51821", handshake, 1000, 2000),
+			Now:   now,
+			State: state(peerStat("[2001:db8::1]:51821", handshake, 1000, 2000), 0, 0, 0, 0, false),
+			Events: []event.Event{
+				{Type: event.Statistics, Time: handshake, Peer: state(peerStat("[2001:db8::1]:51820", handshake, 1000, 2000), 0, 0, 0, 0, false)},
+				{Type: event.EndpointUpdated, Time: handshake, Peer: state(peerStat("[2001:db8::1]:51821", handshake, 1000, 2000), 0, 0, 0, 0, false)},
+			},
+		},
+		{
+			Name:  "handshake",
+			Prev:  lastState,
+			Stat:  peerStat("192.0.2.1:51820", handshake.Add(2*time.Minute), 1100, 2200),
+			Now:   now,
+			State: state(peerStat("192.0.2.1:51820", handshake.Add(2*time.Minute), 1100, 2200), 400, 600, 600, 800, false),
+			Events: []event.Event{
+				{Type: event.Handshake, Time: handshake.Add(2 * time.Minute), Peer: state(peerStat("192.0.2.1:51820", handshake.Add(2*time.Minute), 1100, 2200), 400, 600, 600, 800, false)},
+			},
+		},
+		{
+			Name: "handshake restored with another location",
+			Prev: lastState,
+			Stat: peerStat("192.0.2.1:51820", handshake.In(time.FixedZone("JST", 9*60*60)), 1000, 2000),
+			Now:  now,
+			State: func() State {
+				s := lastState
+				s.LatestHandshake = handshake.In(time.FixedZone("JST", 9*60*60))
+				return s
+			}(),
+		},
+		{
+			Name:  "inactivity",
+			Prev:  lastState,
+			Stat:  last,
+			Now:   handshake.Add(45 * time.Minute),
+			State: state(last, 300, 400, 500, 600, true),
+			Events: []event.Event{
+				{Type: event.SuspectedInactive, Time: handshake, Peer: state(last, 300, 400, 500, 600, false), InactiveMinutes: 45},
+			},
+		},
+		{
+			Name:   "inactivity is reported once",
+			Prev:   state(last, 300, 400, 500, 600, true),
+			Stat:   last,
+			Now:    handshake.Add(60 * time.Minute),
+			State:  state(last, 300, 400, 500, 600, true),
+			Events: nil,
+		},
+		{
+			Name:  "transfer after inactivity",
+			Prev:  state(last, 300, 400, 500, 600, true),
+			Stat:  peerStat("192.0.2.1:51820", handshake, 1100, 2000),
+			Now:   handshake.Add(60 * time.Minute),
+			State: state(peerStat("192.0.2.1:51820", handshake, 1100, 2000), 400, 400, 600, 600, false),
+		},
+		{
+			Name:  "inactive without handshake",
+			Prev:  state(peerStat("192.0.2.1:51820", time.Unix(0, 0), 0, 0), 0, 0, 0, 0, false),
+			Stat:  peerStat("192.0.2.1:51820", time.Unix(0, 0), 0, 0),
+			Now:   now,
+			State: state(peerStat("192.0.2.1:51820", time.Unix(0, 0), 0, 0), 0, 0, 0, 0, false),
+		},
+		{
+			Name: "counter reset",
+			Prev: lastState,
+			Stat: peerStat("192.0.2.1:51820", handshake.Add(2*time.Minute), 100, 2100),
+			Now:  now,
+			// current rx is used as transferred bytes
+			State: state(peerStat("192.0.2.1:51820", handshake.Add(2*time.Minute), 100, 2100), 400, 500, 600, 700, false),
+			Events: []event.Event{
+				{Type: event.Handshake, Time: handshake.Add(2 * time.Minute), Peer: state(peerStat("192.0.2.1:51820", handshake.Add(2*time.Minute), 100, 2100), 400, 500, 600, 700, false)},
+			},
+		},
+	}
+
+	for _, tt := range detectTests {
+		cur, events := detector.Detect(tt.Prev, tt.Stat, tt.Now)
+		assert.Equal(t, tt.State, cur, tt.Name)
+		assert.Equal(t, tt.Events, events, tt.Name)
+	}
+}
+
+func TestRotated(t *testing.T) {
+	prev := state(peerStat("192.0.2.1:51820", handshake, 1000, 2000), 0, 0, 0, 0, false)
+	rx, tx := Rotated(prev, peerStat("192.0.2.1:51820", handshake, 100, 2000))
+	assert.True(t, rx)
+	assert.False(t, tx)
+}
+
+func TestEndpointIP(t *testing.T) {
+	assert.Equal(t, "192.0.2.1", EndpointIP("192.0.2.1:51820"))
+	assert.Equal(t, "[2001:db8::1]", EndpointIP("[2001:db8::1]:51820"))
+	assert.Equal(t, "(none)", EndpointIP("(none)"))
+}
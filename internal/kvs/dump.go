@@ -0,0 +1,176 @@
+package kvs
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DumpHeader is the first line of dump data.
+type DumpHeader struct {
+	SchemaVersion int       `json:"schema_version"`
+	ExportedAt    time.Time `json:"exported_at"`
+}
+
+// Entry is a key/value in a bucket, or a record of the event history.
+type Entry struct {
+	Bucket string          `json:"bucket"`
+	Key    string          `json:"key"`
+	Time   *time.Time      `json:"time,omitempty"`
+	Event  string          `json:"event,omitempty"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// IsHistory reports whether the entry is a record of the event history.
+func (e Entry) IsHistory() bool {
+	return e.Bucket == historyBucket
+}
+
+// Record returns the entry as a record of the event history.
+func (e Entry) Record() Record {
+	r := Record{
+		Key:   e.Key,
+		Event: e.Event,
+		Data:  []byte(e.Value),
+	}
+	if e.Time != nil {
+		r.Time = *e.Time
+	}
+	return r
+}
+
+func historyEntry(r Record) Entry {
+	t := r.Time
+	return Entry{
+		Bucket: historyBucket,
+		Key:    r.Key,
+		Time:   &t,
+		Event:  r.Event,
+		Value:  json.RawMessage(r.Data),
+	}
+}
+
+// Export writes every entry of the store as JSON Lines.
+// The first line is DumpHeader.
+func Export(store Store, w io.Writer) (entries int, err error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err = enc.Encode(DumpHeader{
+		SchemaVersion: SchemaVersion,
+		ExportedAt:    time.Now(),
+	}); err != nil {
+		return
+	}
+
+	err = store.Dump(func(e Entry) error {
+		if !json.Valid(e.Value) {
+			return fmt.Errorf("bucket '%s' key '%s' is not JSON", e.Bucket, e.Key)
+		}
+		entries++
+		return enc.Encode(e)
+	})
+	if err != nil {
+		return
+	}
+	err = bw.Flush()
+	return
+}
+
+// ReadDump reads JSON Lines written by Export.
+// Peer records in bucket and history are migrated into SchemaVersion when the dump is older.
+// validate is called for each entry, and the first error is returned with line number.
+func ReadDump(r io.Reader, bucket string, validate func(Entry) error) (header DumpHeader, entries []Entry, err error) {
+	var pending []Migration
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	// the first non-empty line is the header
+	headerRead := false
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		if !headerRead {
+			headerRead = true
+			if err = json.Unmarshal(line, &header); err != nil {
+				return header, nil, fmt.Errorf("line %d: invalid header: %w", lineNumber, err)
+			}
+			if header.SchemaVersion <= 0 {
+				return header, nil, fmt.Errorf("line %d: unsupported schema version %d", lineNumber, header.SchemaVersion)
+			}
+			if pending, err = pendingMigrations(header.SchemaVersion); err != nil {
+				return header, nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			continue
+		}
+
+		var e Entry
+		if err = json.Unmarshal(line, &e); err != nil {
+			return header, nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if e.Bucket == "" || e.Key == "" {
+			return header, nil, fmt.Errorf("line %d: bucket and key are required", lineNumber)
+		}
+		if e.IsHistory() && e.Time == nil {
+			return header, nil, fmt.Errorf("line %d: time is required for history", lineNumber)
+		}
+		if e.Bucket == metaBucket {
+			// metadata is rebuilt by the destination database
+			continue
+		}
+		if e.IsHistory() || e.Bucket == bucket {
+			if e.Value, err = migrateRecord(pending, e.Value); err != nil {
+				return header, nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		}
+		if validate != nil {
+			if err = validate(e); err != nil {
+				return header, nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		}
+		entries = append(entries, e)
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if !headerRead {
+		err = fmt.Errorf("no header found")
+	}
+	return
+}
+
+// Import writes entries into the store. bbolt and SQLite write them in a transaction,
+// so nothing is written when it fails. Other stores write them one by one.
+func Import(store Store, entries []Entry) error {
+	if s, ok := store.(interface{ RestoreAll([]Entry) error }); ok {
+		return s.RestoreAll(entries)
+	}
+	for _, e := range entries {
+		if err := store.Restore(e); err != nil {
+			return fmt.Errorf("cannot import bucket '%s' key '%s': %w", e.Bucket, e.Key, err)
+		}
+	}
+	return nil
+}
+
+var errNotEmpty = errors.New("not empty")
+
+// IsEmpty reports whether the store has no entry in any bucket, including the event history.
+func IsEmpty(store Store) (bool, error) {
+	err := store.Dump(func(Entry) error {
+		return errNotEmpty
+	})
+	switch err {
+	case nil:
+		return true, nil
+	case errNotEmpty:
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,103 @@
+package kvs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	stores := openTestStores(t)
+	src, dst := stores[DriverBolt], stores[DriverSQLite]
+
+	assert.NoError(t, src.Set("peer1", []byte(`{"a":1}`)))
+	assert.NoError(t, src.AppendEvent(Record{Key: "peer1", Time: time.Unix(1599229650, 0), Event: "handshake", Data: []byte(`{"a":1}`)}))
+
+	var buf bytes.Buffer
+	n, err := Export(src, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 3, strings.Count(buf.String(), "\n"))
+
+	header, entries, err := ReadDump(&buf, "main", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion, header.SchemaVersion)
+	assert.NoError(t, Import(dst, entries))
+
+	assert.Equal(t, `{"a":1}`, string(dst.Get("peer1")))
+	history, _ := dst.History(Query{Key: "peer1"})
+	if assert.Len(t, history, 1) {
+		assert.True(t, history[0].Time.Equal(time.Unix(1599229650, 0)))
+	}
+}
+
+func TestImport_Atomic(t *testing.T) {
+	for driver, s := range openTestStores(t) {
+		entries := []Entry{
+			{Bucket: "main", Key: "peer1", Value: []byte(`{"a":1}`)},
+			{Bucket: "history", Key: "peer1", Event: "handshake", Value: []byte(`{}`)},
+		}
+		if driver == DriverBolt {
+			// bucket name is required by bbolt
+			entries = append(entries, Entry{Bucket: "", Key: "peer2", Value: []byte(`{}`)})
+			assert.Error(t, Import(s, entries), driver)
+			empty, err := IsEmpty(s)
+			assert.NoError(t, err, driver)
+			assert.True(t, empty, driver)
+			entries = entries[:2]
+		}
+		assert.NoError(t, Import(s, entries), driver)
+		assert.Equal(t, `{"a":1}`, string(s.Get("peer1")), driver)
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	for driver, s := range openTestStores(t) {
+		empty, err := IsEmpty(s)
+		assert.NoError(t, err, driver)
+		assert.True(t, empty, driver)
+
+		// history only
+		assert.NoError(t, s.AppendEvent(Record{Key: "peer1", Time: time.Unix(1599229650, 0), Event: "handshake", Data: []byte(`{}`)}), driver)
+		empty, err = IsEmpty(s)
+		assert.NoError(t, err, driver)
+		assert.False(t, empty, driver)
+	}
+}
+
+func TestReadDump_LeadingBlankLine(t *testing.T) {
+	input := fmt.Sprintf("\n{\"schema_version\":%d}\n", SchemaVersion) + `{"bucket":"main","key":"peer1","value":{}}`
+	header, entries, err := ReadDump(strings.NewReader(input), "main", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion, header.SchemaVersion)
+	assert.Len(t, entries, 1)
+}
+
+func TestReadDump_Invalid(t *testing.T) {
+	header := fmt.Sprintf(`{"schema_version":%d}`, SchemaVersion)
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"blank lines", "\n\n"},
+		{"no header after blank line", "\n" + `{"bucket":"main","key":"peer1","value":{}}`},
+		{"unsupported version", `{"schema_version":999}`},
+		{"broken line", header + "\n{\"bucket\":"},
+		{"no key", header + "\n" + `{"bucket":"main","value":{}}`},
+		{"history without time", header + "\n" + `{"bucket":"history","key":"peer1","value":{}}`},
+	}
+	for _, tt := range tests {
+		_, _, err := ReadDump(strings.NewReader(tt.input), "main", nil)
+		assert.Error(t, err, tt.name)
+	}
+
+	_, _, err := ReadDump(strings.NewReader(header+"\n"+`{"bucket":"main","key":"peer1","value":{}}`), "main", func(Entry) error {
+		return fmt.Errorf("rejected")
+	})
+	assert.EqualError(t, err, "line 2: rejected")
+}
@@ -1,7 +1,11 @@
 package kvs
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 )
@@ -17,13 +21,103 @@ func Open(dbPath string, bucket string) (kvs *KVS, err error) {
 		DBPath: dbPath,
 		Bucket: bucket,
 	}
-	kvs.db, err = bolt.Open(dbPath, 0666, nil)
+	// do not wait forever while another process (e.g. running daemon) locks the database
+	kvs.db, err = bolt.Open(dbPath, 0666, &bolt.Options{Timeout: 3 * time.Second})
 	if err != nil {
 		return
 	}
+	if err = kvs.migrate(); err != nil {
+		kvs.db.Close()
+		return nil, fmt.Errorf("cannot migrate database '%s': %w", dbPath, err)
+	}
 	return
 }
 
+// migrate applies pending migrations and records the schema version.
+func (kvs *KVS) migrate() error {
+	return kvs.db.Update(func(tx *bolt.Tx) error {
+		version := 0
+		var v []byte
+		if meta := tx.Bucket([]byte(metaBucket)); meta != nil {
+			v = meta.Get([]byte(schemaVersionKey))
+		}
+		switch {
+		case v != nil:
+			var err error
+			if version, err = decodeSchemaVersion(v); err != nil {
+				return err
+			}
+		case tx.Bucket([]byte(kvs.Bucket)) == nil && tx.Bucket([]byte(historyBucket)) == nil:
+			// new database
+			version = SchemaVersion
+		}
+
+		pending, err := pendingMigrations(version)
+		if err != nil {
+			return err
+		}
+
+		// peer records can not be updated in ForEach, so collect them first
+		if b := tx.Bucket([]byte(kvs.Bucket)); b != nil && len(pending) > 0 {
+			records := map[string][]byte{}
+			if err := b.ForEach(func(k, v []byte) error {
+				records[string(k)] = append([]byte(nil), v...)
+				return nil
+			}); err != nil {
+				return err
+			}
+			for k, v := range records {
+				if v, err = migrateRecord(pending, v); err != nil {
+					return fmt.Errorf("key '%s': %w", k, err)
+				}
+				if err = b.Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+		}
+		if b := tx.Bucket([]byte(historyBucket)); b != nil && len(pending) > 0 {
+			records := map[string]historyValue{}
+			if err := b.ForEach(func(k, v []byte) error {
+				var hv historyValue
+				if err := json.Unmarshal(v, &hv); err != nil {
+					return err
+				}
+				records[string(k)] = hv
+				return nil
+			}); err != nil {
+				return err
+			}
+			for k, hv := range records {
+				data, err := migrateRecord(pending, hv.Data)
+				if err != nil {
+					return fmt.Errorf("history of '%s': %w", hv.Key, err)
+				}
+				hv.Data = data
+				if v, err = json.Marshal(hv); err != nil {
+					return err
+				}
+				if err = b.Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+		}
+
+		meta, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+		if err != nil {
+			return err
+		}
+		return meta.Put([]byte(schemaVersionKey), encodeSchemaVersion(SchemaVersion))
+	})
+}
+
+func (kvs *KVS) WithBucket(bucket string) Store {
+	return &KVS{
+		DBPath: kvs.DBPath,
+		Bucket: bucket,
+		db:     kvs.db,
+	}
+}
+
 func (kvs *KVS) Close() {
 	kvs.db.Close()
 }
@@ -75,3 +169,279 @@ func (kvs *KVS) Set(key string, json []byte) (err error) {
 	}
 	return nil
 }
+
+func (kvs *KVS) ForEach(fn func(key string, json []byte) error) error {
+	return kvs.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(kvs.Bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+// historyBucket is the bucket name to store event history
+const historyBucket = "history"
+
+type historyValue struct {
+	Key   string          `json:"key"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+func (kvs *KVS) AppendEvent(record Record) error {
+	return kvs.db.Update(func(tx *bolt.Tx) error {
+		return appendEvent(tx, record)
+	})
+}
+
+func appendEvent(tx *bolt.Tx, record Record) error {
+	v, err := json.Marshal(historyValue{
+		Key:   record.Key,
+		Event: record.Event,
+		Data:  record.Data,
+	})
+	if err != nil {
+		return err
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(historyBucket))
+	if err != nil {
+		return err
+	}
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	// key is the recorded time and sequence, so records are sorted by time
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k[0:8], uint64(record.Time.UnixNano()))
+	binary.BigEndian.PutUint64(k[8:16], seq)
+	return b.Put(k, v)
+}
+
+// historyKeyTime returns the time part of history keys.
+func historyKeyTime(t time.Time) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	return k
+}
+
+func (kvs *KVS) History(query Query) (records []Record, err error) {
+	err = kvs.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(historyBucket))
+		if b == nil {
+			return nil
+		}
+		// keys are sorted by time, so seek to Since and stop at Until
+		c := b.Cursor()
+		k, v := c.First()
+		if !query.Since.IsZero() {
+			k, v = c.Seek(historyKeyTime(query.Since))
+		}
+		for ; k != nil; k, v = c.Next() {
+			if len(k) != 16 {
+				return fmt.Errorf("invalid history key '%x'", k)
+			}
+			if !query.Until.IsZero() && bytes.Compare(k[0:8], historyKeyTime(query.Until)) >= 0 {
+				break
+			}
+			var hv historyValue
+			if err := json.Unmarshal(v, &hv); err != nil {
+				return err
+			}
+			r := Record{
+				Key:   hv.Key,
+				Time:  time.Unix(0, int64(binary.BigEndian.Uint64(k[0:8]))),
+				Event: hv.Event,
+				Data:  []byte(hv.Data),
+			}
+			if query.match(r) {
+				records = append(records, r)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (kvs *KVS) PruneHistory(before time.Time) (n int, err error) {
+	err = kvs.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(historyBucket))
+		if b == nil {
+			return nil
+		}
+		end := historyKeyTime(before)
+		c := b.Cursor()
+		for k, _ := c.First(); len(k) == 16 && bytes.Compare(k[0:8], end) < 0; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return
+}
+
+func (kvs *KVS) Dump(fn func(Entry) error) error {
+	var buckets []string
+	err := kvs.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			// logs waiting in the outbox are not states
+			if string(name) == metaBucket || string(name) == outboxBucket {
+				return nil
+			}
+			buckets = append(buckets, string(name))
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range buckets {
+		if bucket == historyBucket {
+			records, err := kvs.History(Query{})
+			if err != nil {
+				return err
+			}
+			for _, r := range records {
+				if err := fn(historyEntry(r)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		err := kvs.db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+				if v == nil {
+					return fmt.Errorf("nested bucket '%s' in '%s' is not supported", k, bucket)
+				}
+				return fn(Entry{
+					Bucket: bucket,
+					Key:    string(k),
+					Value:  append([]byte(nil), v...),
+				})
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (kvs *KVS) Restore(entry Entry) error {
+	return kvs.db.Update(func(tx *bolt.Tx) error {
+		return restore(tx, entry)
+	})
+}
+
+// RestoreAll writes entries in a transaction, so nothing is written when it fails.
+func (kvs *KVS) RestoreAll(entries []Entry) error {
+	return kvs.db.Update(func(tx *bolt.Tx) error {
+		for _, e := range entries {
+			if err := restore(tx, e); err != nil {
+				return fmt.Errorf("cannot import bucket '%s' key '%s': %w", e.Bucket, e.Key, err)
+			}
+		}
+		return nil
+	})
+}
+
+func restore(tx *bolt.Tx, entry Entry) error {
+	if entry.IsHistory() {
+		return appendEvent(tx, entry.Record())
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(entry.Bucket))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(entry.Key), entry.Value)
+}
+
+// outboxQueue returns the bucket of the queue nested in outboxBucket, or nil.
+func outboxQueue(tx *bolt.Tx, queue string, create bool) (*bolt.Bucket, error) {
+	if !create {
+		if b := tx.Bucket([]byte(outboxBucket)); b != nil {
+			return b.Bucket([]byte(queue)), nil
+		}
+		return nil, nil
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(outboxBucket))
+	if err != nil {
+		return nil, err
+	}
+	return b.CreateBucketIfNotExists([]byte(queue))
+}
+
+func (kvs *KVS) outboxAppend(queue string, data []byte) (id uint64, err error) {
+	err = kvs.db.Update(func(tx *bolt.Tx) error {
+		b, err := outboxQueue(tx, queue, true)
+		if err != nil {
+			return err
+		}
+		if id, err = b.NextSequence(); err != nil {
+			return err
+		}
+		return b.Put(encodeID(id), data)
+	})
+	return
+}
+
+func (kvs *KVS) outboxPeek(queue string, n int) (messages []Message, err error) {
+	err = kvs.db.View(func(tx *bolt.Tx) error {
+		b, _ := outboxQueue(tx, queue, false)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.First(); k != nil && len(messages) < n; k, v = c.Next() {
+			messages = append(messages, Message{
+				ID:   binary.BigEndian.Uint64(k),
+				Data: append([]byte(nil), v...),
+			})
+		}
+		return nil
+	})
+	return
+}
+
+func (kvs *KVS) outboxAck(queue string, ids []uint64) (deleted int, err error) {
+	err = kvs.db.Update(func(tx *bolt.Tx) error {
+		deleted = 0
+		b, _ := outboxQueue(tx, queue, false)
+		if b == nil {
+			return nil
+		}
+		for _, id := range ids {
+			k := encodeID(id)
+			if b.Get(k) == nil {
+				continue
+			}
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		deleted = 0
+	}
+	return
+}
+
+func (kvs *KVS) outboxLen(queue string) (n int, err error) {
+	err = kvs.db.View(func(tx *bolt.Tx) error {
+		if b, _ := outboxQueue(tx, queue, false); b != nil {
+			n = b.Stats().KeyN
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,101 @@
+package kvs
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the version of the data format stored in the database.
+const SchemaVersion = 2
+
+// Migration converts data stored with the previous schema version into Version.
+type Migration struct {
+	// Version is the schema version after migration
+	Version int
+	// Description describes the migration
+	Description string
+	// Record converts a JSON encoded peer record (state and history data).
+	// nil means records are not changed.
+	Record func(json []byte) ([]byte, error)
+}
+
+// migrations must be ordered by Version.
+// Append a new migration and bump SchemaVersion when the record format is changed.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "add schema version to unversioned database",
+	},
+	{
+		Version:     2,
+		Description: "rename 'Transfered*' fields to 'Transferred*'",
+		Record: renameFields(map[string]string{
+			"TransferedRXPerEndpoint":   "TransferredRXPerEndpoint",
+			"TransferedTXPerEndpoint":   "TransferredTXPerEndpoint",
+			"TransferedRXPerEndpointIP": "TransferredRXPerEndpointIP",
+			"TransferedTXPerEndpointIP": "TransferredTXPerEndpointIP",
+		}),
+	},
+}
+
+const (
+	// metaBucket is the bucket name to store metadata of database
+	metaBucket = "meta"
+	// schemaVersionKey is the key of schema version in metaBucket
+	schemaVersionKey = "schema_version"
+)
+
+func renameFields(names map[string]string) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+		for from, to := range names {
+			if v, ok := fields[from]; ok {
+				fields[to] = v
+				delete(fields, from)
+			}
+		}
+		return json.Marshal(fields)
+	}
+}
+
+// pendingMigrations returns migrations to apply to the data with version.
+func pendingMigrations(version int) ([]Migration, error) {
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("schema version %d is newer than supported version %d", version, SchemaVersion)
+	}
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// migrateRecord applies migrations to a JSON encoded peer record.
+func migrateRecord(ms []Migration, data []byte) ([]byte, error) {
+	var err error
+	for _, m := range ms {
+		if m.Record == nil {
+			continue
+		}
+		if data, err = m.Record(data); err != nil {
+			return nil, fmt.Errorf("migration to version %d failed: %w", m.Version, err)
+		}
+	}
+	return data, nil
+}
+
+func encodeSchemaVersion(version int) []byte {
+	return []byte(fmt.Sprintf("%d", version))
+}
+
+func decodeSchemaVersion(v []byte) (version int, err error) {
+	if err = json.Unmarshal(v, &version); err != nil {
+		return 0, fmt.Errorf("invalid schema version '%s'", v)
+	}
+	return
+}
@@ -0,0 +1,134 @@
+package kvs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+// copyFixture copies a fixture database into a temporary directory, because Open migrates it in place.
+func copyFixture(t *testing.T, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join("../../test", name))
+	if err != nil {
+		t.Fatalf("Cannot read fixture: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Cannot write fixture: %v", err)
+	}
+	return path
+}
+
+func schemaVersionOf(t *testing.T, path string) int {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("Cannot open database: %v", err)
+	}
+	defer db.Close()
+
+	version := 0
+	_ = db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(metaBucket)); b != nil {
+			version, _ = decodeSchemaVersion(b.Get([]byte(schemaVersionKey)))
+		}
+		return nil
+	})
+	return version
+}
+
+func TestOpen_MigrateFromV0(t *testing.T) {
+	path := copyFixture(t, "wg-logger-v0.db")
+	assert.Equal(t, 0, schemaVersionOf(t, path))
+
+	s, err := Open(path, "main")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(s.Get("i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA="), &record))
+	assert.EqualValues(t, 1024, record["TransferredRXPerEndpoint"])
+	assert.EqualValues(t, 2048, record["TransferredTXPerEndpoint"])
+	assert.EqualValues(t, 4096, record["TransferredRXPerEndpointIP"])
+	assert.EqualValues(t, 8192, record["TransferredTXPerEndpointIP"])
+	assert.NotContains(t, record, "TransferedRXPerEndpoint")
+	assert.EqualValues(t, "123.45.67.89:64680", record["Endpoint"])
+	s.Close()
+
+	assert.Equal(t, SchemaVersion, schemaVersionOf(t, path))
+
+	// migrated database is opened without changes
+	s, err = Open(path, "main")
+	if assert.NoError(t, err) {
+		assert.NoError(t, json.Unmarshal(s.Get("63clN7mNlJ7ckYH7VirX1VyAfXwR4t9DP9DRp2qMu0o="), &record))
+		assert.EqualValues(t, 7479995699, record["TransferredRXPerEndpointIP"])
+		assert.Equal(t, true, record["SuspectedInactive"])
+		s.Close()
+	}
+}
+
+func TestOpen_NewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "newer.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucketIfNotExists([]byte(metaBucket))
+		return b.Put([]byte(schemaVersionKey), encodeSchemaVersion(SchemaVersion+1))
+	})
+	db.Close()
+
+	_, err = Open(path, "main")
+	assert.Error(t, err)
+}
+
+func TestOpenSQLite_MigrateFromV0(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "v0.sqlite")
+	s, err := OpenSQLite(path, "main")
+	if !assert.NoError(t, err) {
+		return
+	}
+	// make an unversioned database
+	_, err = s.db.Exec(`DELETE FROM state`)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Set("peer1", []byte(`{"PublicKey":"peer1","TransferedRXPerEndpointIP":10}`)))
+	assert.NoError(t, s.AppendEvent(Record{Key: "peer1", Event: "handshake", Data: []byte(`{"TransferedTXPerEndpoint":20}`)}))
+	s.Close()
+
+	s, err = OpenSQLite(path, "main")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+	assert.JSONEq(t, `{"PublicKey":"peer1","TransferredRXPerEndpointIP":10}`, string(s.Get("peer1")))
+	history, _ := s.History(Query{})
+	if assert.Len(t, history, 1) {
+		assert.JSONEq(t, `{"TransferredTXPerEndpoint":20}`, string(history[0].Data))
+	}
+}
+
+func TestReadDump_MigrateFromV1(t *testing.T) {
+	f, err := os.Open("../../test/wg-logger-v1.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	header, entries, err := ReadDump(f, "main", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, header.SchemaVersion)
+	if assert.Len(t, entries, 2) {
+		for _, e := range entries {
+			assert.Contains(t, string(e.Value), `"TransferredRXPerEndpointIP":4096`)
+			assert.NotContains(t, string(e.Value), `Transfered`)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package kvs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// outboxBucket is the bucket of bbolt, or the table of SQLite, to store the outbox
+const outboxBucket = "outbox"
+
+// outboxStore is implemented by stores which keep the outbox in their database.
+type outboxStore interface {
+	outboxAppend(queue string, data []byte) (uint64, error)
+	outboxPeek(queue string, n int) ([]Message, error)
+	// outboxAck returns the number of deleted messages
+	outboxAck(queue string, ids []uint64) (int, error)
+	outboxLen(queue string) (int, error)
+}
+
+// Outbox is the durable queue of logs for remote sinks, in the database of the store.
+// Logs are appended before delivery, and deleted after the server acknowledges them.
+// Each sink has its own queue of the same name.
+type Outbox struct {
+	store outboxStore
+
+	mu     sync.Mutex
+	queues map[string]*Queue
+}
+
+// Message is a log waiting for delivery. ID is increasing in the queue.
+type Message struct {
+	ID   uint64
+	Data []byte
+}
+
+// NewOutbox returns the outbox in the database of the store.
+// The outbox is closed with the store.
+func NewOutbox(store Store) (*Outbox, error) {
+	s, ok := store.(outboxStore)
+	if !ok {
+		return nil, fmt.Errorf("the database does not support outbox")
+	}
+	return &Outbox{store: s, queues: make(map[string]*Queue)}, nil
+}
+
+// Queue returns the queue of the sink. The same queue is returned for the same name.
+func (o *Outbox) Queue(name string) (*Queue, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if q, ok := o.queues[name]; ok {
+		return q, nil
+	}
+	// messages left by the last run are counted once, Len is called on every log
+	n, err := o.store.outboxLen(name)
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{store: o.store, name: name, n: n}
+	o.queues[name] = q
+	return q, nil
+}
+
+// Queue is the queue of a sink in the outbox.
+type Queue struct {
+	store outboxStore
+	name  string
+
+	// mu guards n, the number of messages in the queue
+	mu sync.Mutex
+	n  int
+}
+
+// Append adds data at the end of the queue, it is written to disk when returned.
+func (q *Queue) Append(data []byte) (id uint64, err error) {
+	if id, err = q.store.outboxAppend(q.name, data); err != nil {
+		return 0, err
+	}
+	q.mu.Lock()
+	q.n++
+	q.mu.Unlock()
+	return id, nil
+}
+
+// Peek returns at most n messages from the head of the queue, without removing them.
+func (q *Queue) Peek(n int) ([]Message, error) {
+	return q.store.outboxPeek(q.name, n)
+}
+
+// Ack removes delivered messages.
+func (q *Queue) Ack(ids ...uint64) error {
+	deleted, err := q.store.outboxAck(q.name, ids)
+	q.mu.Lock()
+	q.n -= deleted
+	q.mu.Unlock()
+	return err
+}
+
+// Len returns the number of messages waiting for delivery.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+func encodeID(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
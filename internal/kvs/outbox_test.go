@@ -0,0 +1,88 @@
+package kvs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestOutbox(t *testing.T, s Store) *Outbox {
+	o, err := NewOutbox(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func openTestQueue(t *testing.T, o *Outbox, name string) *Queue {
+	q, err := o.Queue(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestOutbox(t *testing.T) {
+	dir := t.TempDir()
+	for _, driver := range []string{DriverBolt, DriverSQLite} {
+		path := filepath.Join(dir, driver+".db")
+		s, err := OpenStore(driver, path, "main")
+		if !assert.NoError(t, err, driver) {
+			continue
+		}
+		o := openTestOutbox(t, s)
+
+		q := openTestQueue(t, o, "fluent")
+		assert.Equal(t, 0, q.Len(), driver)
+		messages, err := q.Peek(10)
+		assert.NoError(t, err, driver)
+		assert.Empty(t, messages, driver)
+		assert.NoError(t, q.Ack(1), driver)
+
+		var ids []uint64
+		for _, data := range []string{"1st", "2nd", "3rd"} {
+			id, err := q.Append([]byte(data))
+			assert.NoError(t, err, driver)
+			ids = append(ids, id)
+		}
+		_, err = openTestQueue(t, o, "webhook").Append([]byte("other"))
+		assert.NoError(t, err, driver)
+
+		messages, err = q.Peek(2)
+		assert.NoError(t, err, driver)
+		assert.Equal(t, []Message{{ID: ids[0], Data: []byte("1st")}, {ID: ids[1], Data: []byte("2nd")}}, messages, driver)
+		assert.NoError(t, q.Ack(ids[0]), driver)
+		assert.Equal(t, 2, q.Len(), driver)
+		// acked twice
+		assert.NoError(t, q.Ack(ids[0]), driver)
+		assert.Equal(t, 2, q.Len(), driver)
+		assert.Same(t, q, openTestQueue(t, o, "fluent"), driver)
+
+		// logs waiting in the outbox are not states
+		empty, err := IsEmpty(s)
+		assert.NoError(t, err, driver)
+		assert.True(t, empty, driver)
+
+		// messages are kept after restart
+		s.Close()
+		s, err = OpenStore(driver, path, "main")
+		if !assert.NoError(t, err, driver) {
+			continue
+		}
+		o = openTestOutbox(t, s)
+		q = openTestQueue(t, o, "fluent")
+		assert.Equal(t, 2, q.Len(), driver)
+		messages, err = q.Peek(10)
+		assert.NoError(t, err, driver)
+		assert.Equal(t, []Message{{ID: ids[1], Data: []byte("2nd")}, {ID: ids[2], Data: []byte("3rd")}}, messages, driver)
+
+		// IDs are not reused
+		id, err := q.Append([]byte("4th"))
+		assert.NoError(t, err, driver)
+		assert.Greater(t, id, ids[2], driver)
+		assert.Equal(t, 3, q.Len(), driver)
+		assert.Equal(t, 1, openTestQueue(t, o, "webhook").Len(), driver)
+		s.Close()
+	}
+}
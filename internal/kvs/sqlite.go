@@ -0,0 +1,395 @@
+package kvs
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	// pure-Go SQLite driver
+	_ "modernc.org/sqlite"
+)
+
+// SQLite is the Store implementation with SQLite.
+// Tables are designed to be queried by hand, e.g.
+//
+//	SELECT time, event, json_extract(data, '$.EndpointIP') FROM history WHERE key = '...';
+type SQLite struct {
+	DBPath string
+	Bucket string
+	db     *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS state (
+	bucket TEXT NOT NULL,
+	key    TEXT NOT NULL,
+	value  TEXT NOT NULL,
+	PRIMARY KEY (bucket, key)
+);
+CREATE TABLE IF NOT EXISTS history (
+	id    INTEGER PRIMARY KEY AUTOINCREMENT,
+	key   TEXT NOT NULL,
+	time  TEXT NOT NULL,
+	event TEXT NOT NULL,
+	data  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS history_key_time ON history (key, time);
+CREATE INDEX IF NOT EXISTS history_time ON history (time);
+CREATE TABLE IF NOT EXISTS outbox (
+	id    INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue TEXT NOT NULL,
+	data  BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS outbox_queue ON outbox (queue, id);
+`
+
+// sqliteTimeFormat is sortable as text
+const sqliteTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+func OpenSQLite(dbPath string, bucket string) (s *SQLite, err error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return
+	}
+	// SQLite does not allow concurrent writers
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot initialize database '%s': %w", dbPath, err)
+	}
+
+	s = &SQLite{
+		DBPath: dbPath,
+		Bucket: bucket,
+		db:     db,
+	}
+	if err = s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot migrate database '%s': %w", dbPath, err)
+	}
+	return s, nil
+}
+
+// migrate applies pending migrations and records the schema version.
+func (s *SQLite) migrate() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	version := 0
+	var v string
+	err = tx.QueryRow(`SELECT value FROM state WHERE bucket = ? AND key = ?`, metaBucket, schemaVersionKey).Scan(&v)
+	switch {
+	case err == nil:
+		if version, err = decodeSchemaVersion([]byte(v)); err != nil {
+			return err
+		}
+	case err == sql.ErrNoRows:
+		var n int
+		if err = tx.QueryRow(`SELECT (SELECT COUNT(*) FROM state) + (SELECT COUNT(*) FROM history)`).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			// new database
+			version = SchemaVersion
+		}
+	default:
+		return err
+	}
+
+	pending, err := pendingMigrations(version)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		if err = migrateRows(tx, `SELECT key, value FROM state WHERE bucket = ?`, `UPDATE state SET value = ? WHERE bucket = ? AND key = ?`, pending, s.Bucket); err != nil {
+			return err
+		}
+		if err = migrateRows(tx, `SELECT id, data FROM history`, `UPDATE history SET data = ? WHERE id = ?`, pending); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(`INSERT INTO state (bucket, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (bucket, key) DO UPDATE SET value = excluded.value`,
+		metaBucket, schemaVersionKey, string(encodeSchemaVersion(SchemaVersion))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateRows applies migrations to the records selected by query (id, record),
+// and writes them with update (record, args..., id).
+func migrateRows(tx *sql.Tx, query string, update string, ms []Migration, args ...interface{}) error {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	records := map[string]string{}
+	for rows.Next() {
+		var id, v string
+		if err := rows.Scan(&id, &v); err != nil {
+			rows.Close()
+			return err
+		}
+		records[id] = v
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, v := range records {
+		data, err := migrateRecord(ms, []byte(v))
+		if err != nil {
+			return fmt.Errorf("record '%s': %w", id, err)
+		}
+		if _, err = tx.Exec(update, append(append([]interface{}{string(data)}, args...), id)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) WithBucket(bucket string) Store {
+	return &SQLite{
+		DBPath: s.DBPath,
+		Bucket: bucket,
+		db:     s.db,
+	}
+}
+
+func (s *SQLite) Close() {
+	s.db.Close()
+}
+
+func (s *SQLite) Get(key string) (json []byte) {
+	var v string
+	err := s.db.QueryRow(`SELECT value FROM state WHERE bucket = ? AND key = ?`, s.Bucket, key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Cannot read database '%s' with error: %v", s.DBPath, err))
+	}
+	return []byte(v)
+}
+
+func (s *SQLite) Set(key string, json []byte) (err error) {
+	_, err = s.db.Exec(`INSERT INTO state (bucket, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (bucket, key) DO UPDATE SET value = excluded.value`,
+		s.Bucket, key, string(json))
+	return
+}
+
+func (s *SQLite) ForEach(fn func(key string, json []byte) error) error {
+	rows, err := s.db.Query(`SELECT key, value FROM state WHERE bucket = ? ORDER BY key`, s.Bucket)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		if err := fn(k, []byte(v)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLite) AppendEvent(record Record) (err error) {
+	_, err = s.db.Exec(`INSERT INTO history (key, time, event, data) VALUES (?, ?, ?, ?)`,
+		record.Key, record.Time.UTC().Format(sqliteTimeFormat), record.Event, string(record.Data))
+	return
+}
+
+func (s *SQLite) History(query Query) (records []Record, err error) {
+	// conditions use history_key_time index
+	var where []string
+	var args []interface{}
+	if query.Key != "" {
+		where = append(where, "key = ?")
+		args = append(args, query.Key)
+	}
+	if query.Event != "" {
+		where = append(where, "event = ?")
+		args = append(args, query.Event)
+	}
+	if !query.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, query.Since.UTC().Format(sqliteTimeFormat))
+	}
+	if !query.Until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, query.Until.UTC().Format(sqliteTimeFormat))
+	}
+	q := `SELECT key, time, event, data FROM history`
+	if len(where) > 0 {
+		q += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	rows, err := s.db.Query(q+` ORDER BY time, id`, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k, t, e, d string
+		if err = rows.Scan(&k, &t, &e, &d); err != nil {
+			return
+		}
+		r := Record{
+			Key:   k,
+			Event: e,
+			Data:  []byte(d),
+		}
+		if r.Time, err = time.Parse(sqliteTimeFormat, t); err != nil {
+			return
+		}
+		records = append(records, r)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *SQLite) PruneHistory(before time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM history WHERE time < ?`, before.UTC().Format(sqliteTimeFormat))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *SQLite) Dump(fn func(Entry) error) error {
+	rows, err := s.db.Query(`SELECT bucket, key, value FROM state WHERE bucket != ? ORDER BY bucket, key`, metaBucket)
+	if err != nil {
+		return err
+	}
+	var entries []Entry
+	for rows.Next() {
+		var b, k, v string
+		if err := rows.Scan(&b, &k, &v); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, Entry{Bucket: b, Key: k, Value: []byte(v)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	records, err := s.History(Query{})
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := fn(historyEntry(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) Restore(entry Entry) (err error) {
+	query, args := restoreStatement(entry)
+	_, err = s.db.Exec(query, args...)
+	return
+}
+
+// RestoreAll writes entries in a transaction, so nothing is written when it fails.
+func (s *SQLite) RestoreAll(entries []Entry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, e := range entries {
+		query, args := restoreStatement(e)
+		if _, err := tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("cannot import bucket '%s' key '%s': %w", e.Bucket, e.Key, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func restoreStatement(entry Entry) (string, []interface{}) {
+	if entry.IsHistory() {
+		r := entry.Record()
+		return `INSERT INTO history (key, time, event, data) VALUES (?, ?, ?, ?)`,
+			[]interface{}{r.Key, r.Time.UTC().Format(sqliteTimeFormat), r.Event, string(r.Data)}
+	}
+	return `INSERT INTO state (bucket, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (bucket, key) DO UPDATE SET value = excluded.value`,
+		[]interface{}{entry.Bucket, entry.Key, string(entry.Value)}
+}
+
+func (s *SQLite) outboxAppend(queue string, data []byte) (uint64, error) {
+	res, err := s.db.Exec(`INSERT INTO outbox (queue, data) VALUES (?, ?)`, queue, data)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return uint64(id), err
+}
+
+func (s *SQLite) outboxPeek(queue string, n int) (messages []Message, err error) {
+	rows, err := s.db.Query(`SELECT id, data FROM outbox WHERE queue = ? ORDER BY id LIMIT ?`, queue, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Message
+		if err = rows.Scan(&m.ID, &m.Data); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (s *SQLite) outboxAck(queue string, ids []uint64) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	deleted := 0
+	for _, id := range ids {
+		res, err := tx.Exec(`DELETE FROM outbox WHERE queue = ? AND id = ?`, queue, id)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += int(n)
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+func (s *SQLite) outboxLen(queue string) (n int, err error) {
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM outbox WHERE queue = ?`, queue).Scan(&n)
+	return
+}
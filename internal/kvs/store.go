@@ -0,0 +1,100 @@
+package kvs
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DriverBolt is the bbolt backend (default)
+	DriverBolt = "bbolt"
+	// DriverSQLite is the pure-Go SQLite backend
+	DriverSQLite = "sqlite"
+)
+
+// Store is the persistent state store used by wg-logger.
+type Store interface {
+	// Get returns the current state stored with key, or nil.
+	Get(key string) []byte
+	// Set stores the current state with key.
+	Set(key string, json []byte) error
+	// ForEach calls fn for each current state in key order.
+	ForEach(fn func(key string, json []byte) error) error
+	// AppendEvent appends a record to the event history.
+	AppendEvent(record Record) error
+	// History returns event records matched with query in time order.
+	History(query Query) ([]Record, error)
+	// PruneHistory removes event records before the time, and returns the number of them.
+	PruneHistory(before time.Time) (int, error)
+	// Dump calls fn for every entry in every bucket except metadata.
+	Dump(fn func(Entry) error) error
+	// Restore writes the entry dumped by Dump.
+	Restore(entry Entry) error
+	// WithBucket returns the store which reads and writes states in another bucket.
+	// The returned store shares the database, so close only the original store.
+	WithBucket(bucket string) Store
+	// Close closes the database.
+	Close()
+}
+
+// Record is an entry of the event history.
+type Record struct {
+	// Key is the key of the state (peer's public key)
+	Key string
+	// Time is the time the event was recorded
+	Time time.Time
+	// Event is the event name
+	Event string
+	// Data is the JSON encoded state at the event
+	Data []byte
+}
+
+// Query is the condition to select history records.
+// Zero values match everything.
+type Query struct {
+	Key   string
+	Event string
+	Since time.Time
+	Until time.Time
+}
+
+func (q Query) match(r Record) bool {
+	if q.Key != "" && q.Key != r.Key {
+		return false
+	}
+	if q.Event != "" && q.Event != r.Event {
+		return false
+	}
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !r.Time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// OpenStore opens the database with the driver.
+func OpenStore(driver string, dbPath string, bucket string) (Store, error) {
+	switch driver {
+	case DriverBolt, "":
+		return Open(dbPath, bucket)
+	case DriverSQLite:
+		return OpenSQLite(dbPath, bucket)
+	default:
+		return nil, fmt.Errorf("unknown database driver '%s'", driver)
+	}
+}
+
+// Copy copies all entries in every bucket from src to dst.
+func Copy(dst Store, src Store) (states int, records int, err error) {
+	err = src.Dump(func(e Entry) error {
+		if e.IsHistory() {
+			records++
+		} else {
+			states++
+		}
+		return dst.Restore(e)
+	})
+	return
+}
@@ -0,0 +1,110 @@
+package kvs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestStores(t *testing.T) map[string]Store {
+	dir := t.TempDir()
+	stores := map[string]Store{}
+	for _, driver := range []string{DriverBolt, DriverSQLite} {
+		s, err := OpenStore(driver, filepath.Join(dir, driver+".db"), "main")
+		if err != nil {
+			t.Fatalf("Cannot open %s: %v", driver, err)
+		}
+		t.Cleanup(s.Close)
+		stores[driver] = s
+	}
+	return stores
+}
+
+func TestStore_GetSet(t *testing.T) {
+	for driver, s := range openTestStores(t) {
+		assert.Nil(t, s.Get("peer1"), driver)
+
+		assert.NoError(t, s.Set("peer1", []byte(`{"a":1}`)), driver)
+		assert.NoError(t, s.Set("peer2", []byte(`{"a":2}`)), driver)
+		assert.NoError(t, s.Set("peer1", []byte(`{"a":3}`)), driver)
+		assert.Equal(t, `{"a":3}`, string(s.Get("peer1")), driver)
+
+		var keys []string
+		assert.NoError(t, s.ForEach(func(key string, _ []byte) error {
+			keys = append(keys, key)
+			return nil
+		}), driver)
+		assert.Equal(t, []string{"peer1", "peer2"}, keys, driver)
+	}
+}
+
+func TestStore_History(t *testing.T) {
+	base := time.Unix(1599229650, 0)
+	for driver, s := range openTestStores(t) {
+		assert.NoError(t, s.AppendEvent(Record{Key: "peer1", Time: base, Event: "handshake", Data: []byte(`{}`)}), driver)
+		assert.NoError(t, s.AppendEvent(Record{Key: "peer2", Time: base.Add(time.Minute), Event: "statistics", Data: []byte(`{}`)}), driver)
+		assert.NoError(t, s.AppendEvent(Record{Key: "peer1", Time: base.Add(2 * time.Minute), Event: "handshake", Data: []byte(`{"b":1}`)}), driver)
+
+		all, err := s.History(Query{})
+		assert.NoError(t, err, driver)
+		assert.Len(t, all, 3, driver)
+
+		got, err := s.History(Query{Key: "peer1", Since: base.Add(time.Second)})
+		assert.NoError(t, err, driver)
+		if assert.Len(t, got, 1, driver) {
+			assert.True(t, got[0].Time.Equal(base.Add(2*time.Minute)), driver)
+			assert.Equal(t, "handshake", got[0].Event, driver)
+			assert.Equal(t, `{"b":1}`, string(got[0].Data), driver)
+		}
+
+		got, err = s.History(Query{Event: "statistics", Until: base.Add(time.Minute)})
+		assert.NoError(t, err, driver)
+		assert.Len(t, got, 0, driver)
+
+		got, err = s.History(Query{Since: base.Add(time.Minute), Until: base.Add(2 * time.Minute)})
+		assert.NoError(t, err, driver)
+		if assert.Len(t, got, 1, driver) {
+			assert.Equal(t, "peer2", got[0].Key, driver)
+		}
+	}
+}
+
+func TestStore_PruneHistory(t *testing.T) {
+	base := time.Unix(1599229650, 0)
+	for driver, s := range openTestStores(t) {
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, s.AppendEvent(Record{Key: "peer1", Time: base.Add(time.Duration(i) * time.Hour), Event: "handshake", Data: []byte(`{}`)}), driver)
+		}
+		n, err := s.PruneHistory(base.Add(time.Hour))
+		assert.NoError(t, err, driver)
+		assert.Equal(t, 1, n, driver)
+
+		all, err := s.History(Query{})
+		assert.NoError(t, err, driver)
+		if assert.Len(t, all, 2, driver) {
+			assert.True(t, all[0].Time.Equal(base.Add(time.Hour)), driver)
+		}
+
+		n, err = s.PruneHistory(base)
+		assert.NoError(t, err, driver)
+		assert.Equal(t, 0, n, driver)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	stores := openTestStores(t)
+	src, dst := stores[DriverBolt], stores[DriverSQLite]
+
+	assert.NoError(t, src.Set("peer1", []byte(`{"a":1}`)))
+	assert.NoError(t, src.AppendEvent(Record{Key: "peer1", Time: time.Unix(1599229650, 0), Event: "handshake", Data: []byte(`{"a":1}`)}))
+
+	states, records, err := Copy(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, states)
+	assert.Equal(t, 1, records)
+	assert.Equal(t, `{"a":1}`, string(dst.Get("peer1")))
+	history, _ := dst.History(Query{Key: "peer1"})
+	assert.Len(t, history, 1)
+}
@@ -0,0 +1,53 @@
+package kvs
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TTLCache stores values with the time stored, to tell whether they are fresh.
+// Stale values are still returned, so callers can fall back on them while the source is unavailable.
+type TTLCache struct {
+	Store Store
+	TTL   time.Duration
+	now   func() time.Time
+}
+
+type ttlValue struct {
+	StoredAt time.Time       `json:"stored_at"`
+	Value    json.RawMessage `json:"value"`
+}
+
+func NewTTLCache(store Store, ttl time.Duration) *TTLCache {
+	return &TTLCache{
+		Store: store,
+		TTL:   ttl,
+		now:   time.Now,
+	}
+}
+
+// Get returns the JSON encoded value stored with key.
+// fresh is false when the value is older than TTL.
+func (c *TTLCache) Get(key string) (value []byte, fresh bool, ok bool) {
+	v := c.Store.Get(key)
+	if v == nil {
+		return nil, false, false
+	}
+	var tv ttlValue
+	if err := json.Unmarshal(v, &tv); err != nil {
+		return nil, false, false
+	}
+	return []byte(tv.Value), c.now().Sub(tv.StoredAt) < c.TTL, true
+}
+
+// Set stores the JSON encoded value with key.
+func (c *TTLCache) Set(key string, value []byte) error {
+	v, err := json.Marshal(ttlValue{
+		StoredAt: c.now(),
+		Value:    value,
+	})
+	if err != nil {
+		return err
+	}
+	return c.Store.Set(key, v)
+}
@@ -0,0 +1,329 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadChainKey reads the HMAC key of hash chain from the file.
+func ReadChainKey(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimSpace(b)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("hash chain key file '%s' is empty", path)
+	}
+	return key, nil
+}
+
+// chainHash returns HMAC-SHA256 of the line without the line break.
+func chainHash(key []byte, line []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(bytes.TrimRight(line, "\n"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// chainFields are fields added to each line of the hash chained log.
+type chainFields struct {
+	Seq      uint64 `json:"seq"`
+	PrevHash string `json:"prev_hash"`
+}
+
+// chainWriter adds 'seq' and 'prev_hash', the HMAC of the previous line, to each JSON line.
+// Removing, inserting or modifying lines breaks the chain, and it is found by VerifyChain.
+type chainWriter struct {
+	w   io.Writer
+	key []byte
+
+	mu   sync.Mutex
+	seq  uint64
+	prev []byte
+}
+
+// newChainWriter continues the chain from the last line of log files.
+func newChainWriter(w io.Writer, key []byte, path string) (*chainWriter, error) {
+	c := &chainWriter{w: w, key: key}
+	files, err := LogFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	// the current file may be empty just after rotation
+	for i := len(files) - 1; i >= 0 && c.prev == nil; i-- {
+		last, err := lastLine(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if last == nil {
+			continue
+		}
+		c.prev = last
+		var fields chainFields
+		if json.Unmarshal(last, &fields) == nil {
+			c.seq = fields.Seq
+		}
+	}
+	return c, nil
+}
+
+func (c *chainWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	line := bytes.TrimRight(p, "\n")
+	end := bytes.LastIndexByte(line, '}')
+	if end < 0 {
+		return 0, fmt.Errorf("hash chain: log is not JSON object")
+	}
+	prevHash := ""
+	if c.prev != nil {
+		prevHash = chainHash(c.key, c.prev)
+	}
+	fields := fmt.Sprintf(`"seq":%d,"prev_hash":"%s"`, c.seq+1, prevHash)
+	if head := bytes.TrimSpace(line[:end]); len(head) > 0 && head[len(head)-1] != '{' {
+		fields = "," + fields
+	}
+	chained := make([]byte, 0, len(line)+len(fields)+2)
+	chained = append(chained, line[:end]...)
+	chained = append(chained, fields...)
+	chained = append(chained, line[end:]...)
+	chained = append(chained, '\n')
+
+	if _, err := c.w.Write(chained); err != nil {
+		return 0, err
+	}
+	c.seq++
+	c.prev = chained[:len(chained)-1]
+	return len(p), nil
+}
+
+// backupTimeFormat is the timestamp in names of backups rotated by lumberjack.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// LogFiles returns rotated backups of the log file in order, and the log file itself if exists.
+// Backups are named by lumberjack, e.g. wg-2020-09-24T17-00-28.826.log for wg.log,
+// and wg-2020-09-24T17-00-28.826.log.gz when log_compress is enabled.
+func LogFiles(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext) + "-"
+	matches, err := filepath.Glob(prefix + "*" + ext + "*")
+	if err != nil {
+		return nil, err
+	}
+	// other logs like wg-logger.log for wg.log match the pattern too
+	backups := make(map[string]string)
+	var stamps []string
+	for _, m := range matches {
+		name := strings.TrimPrefix(m, prefix)
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		if name != stamp+ext && name != stamp+ext+".gz" {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue
+		}
+		// the uncompressed file is left while it is being compressed
+		if b, ok := backups[stamp]; ok && !strings.HasSuffix(b, ".gz") {
+			continue
+		}
+		if _, ok := backups[stamp]; !ok {
+			stamps = append(stamps, stamp)
+		}
+		backups[stamp] = m
+	}
+	// timestamps in names are sorted lexically
+	sort.Strings(stamps)
+	files := make([]string, 0, len(stamps)+1)
+	for _, stamp := range stamps {
+		files = append(files, backups[stamp])
+	}
+	if _, err = os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// isBackup reports whether the file is named like rotated backups by lumberjack.
+func isBackup(path string) bool {
+	name := filepath.Base(strings.TrimSuffix(path, ".gz"))
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	i := len(stem) - len(backupTimeFormat)
+	if i < 1 || stem[i-1] != '-' {
+		return false
+	}
+	_, err := time.Parse(backupTimeFormat, stem[i:])
+	return err == nil
+}
+
+// openLog opens the log file, and decompresses it when the name ends with '.gz'.
+func openLog(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil || !strings.HasSuffix(path, ".gz") {
+		return f, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// lastLine returns the last non-empty line of the file, or nil.
+func lastLine(path string) ([]byte, error) {
+	f, err := openLog(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var last []byte
+	err = eachLine(f, func(line []byte) error {
+		last = append(last[:0], line...)
+		return nil
+	})
+	return last, err
+}
+
+// eachLine calls fn with non-empty lines without line breaks.
+func eachLine(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ChainProblem is a broken link of the hash chain.
+type ChainProblem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p ChainProblem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// ChainResult is the summary of VerifyChain.
+type ChainResult struct {
+	// Lines is the number of verified lines in the chain
+	Lines int
+	// Unchained is the number of lines before the chain starts, written without hash chain
+	Unchained int
+	FirstSeq  uint64
+	LastSeq   uint64
+	// Rotated is true when the chain starts after seq 1 at the beginning of the earliest backup,
+	// because former backups are deleted by log_max_days or log_max_backups
+	Rotated  bool
+	Problems []ChainProblem
+}
+
+// VerifyChain walks lines of files in order, and reports gaps of sequence numbers and
+// lines whose previous line was modified, inserted or removed.
+// The last line is protected by the next line only, so it can not be verified.
+// The chain may start after seq 1 at the first line of the earliest file when it is a backup,
+// and gaps are reported only inside the remaining files.
+func VerifyChain(files []string, key []byte) (*ChainResult, error) {
+	result := &ChainResult{}
+	var prev []byte
+	var prevFile string
+	var prevLine int
+	started := false
+
+	for _, file := range files {
+		f, err := openLog(file)
+		if err != nil {
+			return nil, err
+		}
+		n := 0
+		err = eachLine(f, func(line []byte) error {
+			n++
+			report := func(format string, a ...interface{}) {
+				result.Problems = append(result.Problems, ChainProblem{File: file, Line: n, Message: fmt.Sprintf(format, a...)})
+			}
+
+			var fields struct {
+				Seq      *uint64 `json:"seq"`
+				PrevHash *string `json:"prev_hash"`
+			}
+			if err := json.Unmarshal(line, &fields); err != nil || fields.Seq == nil || fields.PrevHash == nil {
+				if started {
+					report("line without seq and prev_hash is inserted, or it is modified")
+				} else {
+					result.Unchained++
+				}
+				prev, prevFile, prevLine = append(prev[:0], line...), file, n
+				return nil
+			}
+
+			seq := *fields.Seq
+			switch {
+			case !started:
+				started = true
+				result.FirstSeq = seq
+				result.Rotated = seq != 1 && n == 1 && file == files[0] && isBackup(file)
+				if seq != 1 && !result.Rotated {
+					report("chain starts at seq %d, lines before it are missing", seq)
+				}
+			case seq == result.LastSeq+1:
+			case seq > result.LastSeq+1:
+				report("seq jumps from %d to %d, %d line(s) are missing", result.LastSeq, seq, seq-result.LastSeq-1)
+			case seq == 1:
+				report("chain restarts at seq 1 after seq %d", result.LastSeq)
+			default:
+				report("seq %d is not increasing after seq %d", seq, result.LastSeq)
+			}
+
+			want := ""
+			if prev != nil {
+				want = chainHash(key, prev)
+			}
+			// the previous line is in the deleted backup
+			rotatedOut := result.Rotated && result.Lines == 0
+			if *fields.PrevHash != want && !rotatedOut {
+				if prev == nil {
+					report("prev_hash does not match, lines before it are missing")
+				} else {
+					report("prev_hash does not match, %s:%d is modified or lines are removed", prevFile, prevLine)
+				}
+			}
+
+			result.Lines++
+			result.LastSeq = seq
+			prev, prevFile, prevLine = append(prev[:0], line...), file, n
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return result, nil
+}
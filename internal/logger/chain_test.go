@@ -0,0 +1,174 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+var testChainKey = []byte("secret")
+
+// writeChain writes events to the log file with hash chain, like a run of wg-logger.
+func writeChain(t *testing.T, path string, events ...string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := newChainWriter(f, testChainKey, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zerolog.New(w)
+	for _, e := range events {
+		logger.Log().Str("event", e).Msg("status update")
+	}
+}
+
+func verifyChain(t *testing.T, path string) *ChainResult {
+	files, err := LogFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := VerifyChain(files, testChainKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func problemMessages(result *ChainResult) (messages []string) {
+	for _, p := range result.Problems {
+		messages = append(messages, filepath.Base(p.File)+":"+strings.TrimPrefix(p.String(), p.File+":"))
+	}
+	return
+}
+
+func editLines(t *testing.T, path string, edit func(lines []string) []string) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := edit(strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"))
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChainWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &chainWriter{w: &buf, key: testChainKey}
+	logger := zerolog.New(w)
+	logger.Log().Str("event", "handshake").Msg("status update")
+	logger.Log().Msg("")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Equal(t, `{"event":"handshake","message":"status update","seq":1,"prev_hash":""}`, lines[0])
+	assert.Equal(t, `{"seq":2,"prev_hash":"`+chainHash(testChainKey, []byte(lines[0]))+`"}`, lines[1])
+}
+
+func TestVerifyChain(t *testing.T) {
+	setup := func(t *testing.T) string {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "wg.log")
+		// logs without hash chain, before it is enabled
+		if err := os.WriteFile(path, []byte(`{"event":"old"}`+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		writeChain(t, path, "a", "b")
+		// rotated, and the daemon log in the same directory is not a backup
+		if err := os.Rename(path, filepath.Join(dir, "wg-2020-09-24T17-00-28.826.log")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "wg-logger.log"), []byte("{}\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		// restarted after rotation
+		writeChain(t, path, "c", "d", "e")
+		return path
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		result := verifyChain(t, setup(t))
+		assert.Empty(t, result.Problems)
+		assert.Equal(t, 5, result.Lines)
+		assert.Equal(t, 1, result.Unchained)
+		assert.Equal(t, uint64(1), result.FirstSeq)
+		assert.Equal(t, uint64(5), result.LastSeq)
+		assert.False(t, result.Rotated)
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		path := setup(t)
+		editLines(t, path, func(lines []string) []string {
+			lines[0] = strings.Replace(lines[0], `"c"`, `"x"`, 1)
+			return lines
+		})
+		assert.Equal(t, []string{"wg.log:2: prev_hash does not match, " + path + ":1 is modified or lines are removed"}, problemMessages(verifyChain(t, path)))
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		path := setup(t)
+		editLines(t, path, func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		})
+		assert.Equal(t, []string{
+			"wg.log:2: seq jumps from 3 to 5, 1 line(s) are missing",
+			"wg.log:2: prev_hash does not match, " + path + ":1 is modified or lines are removed",
+		}, problemMessages(verifyChain(t, path)))
+	})
+
+	t.Run("inserted", func(t *testing.T) {
+		path := setup(t)
+		editLines(t, path, func(lines []string) []string {
+			return append([]string{`{"event":"fake"}`}, lines...)
+		})
+		assert.Equal(t, []string{
+			"wg.log:1: line without seq and prev_hash is inserted, or it is modified",
+			"wg.log:2: prev_hash does not match, " + path + ":1 is modified or lines are removed",
+		}, problemMessages(verifyChain(t, path)))
+	})
+
+	t.Run("earliest backup removed", func(t *testing.T) {
+		path := setup(t)
+		dir := filepath.Dir(path)
+		// rotated again, and the first backup is deleted by log_max_backups
+		if err := os.Rename(path, filepath.Join(dir, "wg-2020-09-25T17-00-28.826.log")); err != nil {
+			t.Fatal(err)
+		}
+		writeChain(t, path, "f")
+		if err := os.Remove(filepath.Join(dir, "wg-2020-09-24T17-00-28.826.log")); err != nil {
+			t.Fatal(err)
+		}
+		result := verifyChain(t, path)
+		assert.Empty(t, result.Problems)
+		assert.True(t, result.Rotated)
+		assert.Equal(t, uint64(3), result.FirstSeq)
+		assert.Equal(t, uint64(6), result.LastSeq)
+
+		// gaps in the remaining files are still reported
+		editLines(t, filepath.Join(dir, "wg-2020-09-25T17-00-28.826.log"), func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		})
+		assert.Equal(t, []string{
+			"wg-2020-09-25T17-00-28.826.log:2: seq jumps from 3 to 5, 1 line(s) are missing",
+			"wg-2020-09-25T17-00-28.826.log:2: prev_hash does not match, " + filepath.Join(dir, "wg-2020-09-25T17-00-28.826.log") + ":1 is modified or lines are removed",
+		}, problemMessages(verifyChain(t, path)))
+	})
+
+	t.Run("backup removed", func(t *testing.T) {
+		path := setup(t)
+		if err := os.Remove(filepath.Join(filepath.Dir(path), "wg-2020-09-24T17-00-28.826.log")); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{
+			"wg.log:1: chain starts at seq 3, lines before it are missing",
+			"wg.log:1: prev_hash does not match, lines before it are missing",
+		}, problemMessages(verifyChain(t, path)))
+	})
+}
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"time"
+)
+
+// fluentSender sends logs with the Fluent forward protocol in Message mode,
+// and waits for the ack of each log (at-least-once delivery).
+// Logs without ack are retried, so the server must enable require_ack_response.
+type fluentSender struct {
+	network string
+	address string
+	tag     string
+	timeout time.Duration
+	conn    net.Conn
+}
+
+func newFluentSender(network string, address string, tag string, timeout time.Duration) *fluentSender {
+	return &fluentSender{network: network, address: address, tag: tag, timeout: timeout}
+}
+
+// encodeFluentMessage returns [tag, time, record, {"chunk": chunk}]
+func encodeFluentMessage(tag string, line []byte, chunk string) ([]byte, error) {
+	record, err := decodeJSON(line)
+	if err != nil {
+		return nil, err
+	}
+	t := time.Now()
+	if s, ok := record["time"].(string); ok {
+		if parsed, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			t = parsed
+		}
+	}
+
+	var e msgpackEncoder
+	e.ArrayHeader(4)
+	e.String(tag)
+	e.EventTime(t)
+	if err = e.Value(record); err != nil {
+		return nil, err
+	}
+	e.MapHeader(1)
+	e.String("chunk")
+	e.String(chunk)
+	return e.Bytes(), nil
+}
+
+func (f *fluentSender) Send(line []byte) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	chunk := base64.StdEncoding.EncodeToString(id)
+	msg, err := encodeFluentMessage(f.tag, line, chunk)
+	if err != nil {
+		return permanent(err)
+	}
+
+	if f.conn == nil {
+		if f.conn, err = net.DialTimeout(f.network, f.address, f.timeout); err != nil {
+			f.conn = nil
+			return err
+		}
+	}
+	if err = f.send(msg, chunk); err != nil {
+		f.conn.Close()
+		f.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (f *fluentSender) send(msg []byte, chunk string) error {
+	if err := f.conn.SetDeadline(time.Now().Add(f.timeout)); err != nil {
+		return err
+	}
+	if _, err := f.conn.Write(msg); err != nil {
+		return err
+	}
+	res, err := readMsgpackStringMap(f.conn)
+	if err != nil {
+		return fmt.Errorf("reading ack failed: %w", err)
+	}
+	if res["ack"] != chunk {
+		return fmt.Errorf("unexpected ack '%s' for chunk '%s'", res["ack"], chunk)
+	}
+	return nil
+}
+
+func (f *fluentSender) Close() error {
+	if f.conn == nil {
+		return nil
+	}
+	return f.conn.Close()
+}
@@ -0,0 +1,223 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeMsgpack decodes values written by msgpackEncoder, for testing.
+func decodeMsgpack(r *bufio.Reader) (interface{}, error) {
+	code, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	readN := func(size int) (int, error) {
+		b := make([]byte, size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, err
+		}
+		n := 0
+		for _, c := range b {
+			n = n<<8 | int(c)
+		}
+		return n, nil
+	}
+	readString := func(n int) (interface{}, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return string(b), err
+	}
+	readArray := func(n int) (interface{}, error) {
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	readMap := func(n int) (interface{}, error) {
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := decodeMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			if m[k.(string)], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	switch {
+	case code < 0x80:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xf0 == 0x80:
+		return readMap(int(code & 0x0f))
+	case code&0xf0 == 0x90:
+		return readArray(int(code & 0x0f))
+	case code&0xe0 == 0xa0:
+		return readString(int(code & 0x1f))
+	}
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcb:
+		var bits uint64
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return math.Float64frombits(bits), err
+	case 0xd3:
+		var i int64
+		err := binary.Read(r, binary.BigEndian, &i)
+		return i, err
+	case 0xd7:
+		var ext struct {
+			Type byte
+			Sec  uint32
+			Nsec uint32
+		}
+		err := binary.Read(r, binary.BigEndian, &ext)
+		return time.Unix(int64(ext.Sec), int64(ext.Nsec)).UTC(), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := readN(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return readString(n)
+	case 0xdc, 0xdd:
+		n, err := readN(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readArray(n)
+	case 0xde, 0xdf:
+		n, err := readN(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMap(n)
+	}
+	return nil, fmt.Errorf("unsupported code 0x%02x", code)
+}
+
+func TestFluentSender(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ln.Close()
+
+	received := make(chan interface{}, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					msg, err := decodeMsgpack(r)
+					if err != nil {
+						return
+					}
+					received <- msg
+					option := msg.([]interface{})[3].(map[string]interface{})
+					var e msgpackEncoder
+					e.MapHeader(1)
+					e.String("ack")
+					e.String(option["chunk"].(string))
+					if _, err = conn.Write(e.Bytes()); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	f := newFluentSender("tcp", ln.Addr().String(), "wg-logger", time.Second)
+	defer f.Close()
+	line := `{"event":"handshake","friendly_name":"1st person","labels":{},"peer":{"public_key":"i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=","transfer_rx":1024,"suspected_inactive":false},"time":"2020-09-24T18:12:58.123456789+09:00","message":"status update"}`
+	if !assert.NoError(t, f.Send([]byte(line))) {
+		return
+	}
+
+	msg := (<-received).([]interface{})
+	assert.Equal(t, "wg-logger", msg[0])
+	assert.Equal(t, time.Date(2020, 9, 24, 9, 12, 58, 123456789, time.UTC), msg[1])
+	assert.Equal(t, map[string]interface{}{
+		"event":         "handshake",
+		"friendly_name": "1st person",
+		"labels":        map[string]interface{}{},
+		"peer": map[string]interface{}{
+			"public_key":         "i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=",
+			"transfer_rx":        int64(1024),
+			"suspected_inactive": false,
+		},
+		"time":    "2020-09-24T18:12:58.123456789+09:00",
+		"message": "status update",
+	}, msg[2])
+
+	// reconnects after the collector restarted
+	f.conn.Close()
+	assert.Error(t, f.Send([]byte(line)))
+	assert.NoError(t, f.Send([]byte(line)))
+}
+
+func TestFluentSender_NoAck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// read but never ack
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	f := newFluentSender("tcp", ln.Addr().String(), "wg-logger", 100*time.Millisecond)
+	defer f.Close()
+	err = f.Send([]byte(`{"message":"status update"}`))
+	assert.Error(t, err)
+	assert.Nil(t, f.conn)
+
+	// the log is kept in the outbox and retried, it is never given up
+	var perr *permanentError
+	for i := 0; i < 5; i++ {
+		err = f.Send([]byte(`{"message":"status update"}`))
+		assert.Error(t, err)
+		assert.False(t, errors.As(err, &perr))
+	}
+}
+
+func TestFluentSender_Broken(t *testing.T) {
+	f := newFluentSender("tcp", "127.0.0.1:0", "wg-logger", 100*time.Millisecond)
+	var perr *permanentError
+	assert.True(t, errors.As(f.Send([]byte(`not json`)), &perr))
+}
@@ -0,0 +1,285 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProductVersion is written in headers of CEF and LEEF.
+var ProductVersion = "dev"
+
+const (
+	productVendor = "livesense"
+	productName   = "wg-logger"
+)
+
+// Formats are formats of logs by names in config.
+var Formats = map[string]Format{
+	"json":    FormatJSON,
+	"console": FormatConsole,
+	"logfmt":  FormatLogfmt,
+	"cef":     FormatCEF,
+	"leef":    FormatLEEF,
+}
+
+// field is a value of JSON log, nested keys are joined with '.', e.g. 'peer.public_key'.
+type field struct {
+	Key   string
+	Value string
+}
+
+// flattenJSON returns fields of the JSON line in order.
+// Strings are unquoted, and arrays are kept as JSON.
+func flattenJSON(line []byte) ([]field, error) {
+	var fields []field
+	if err := flattenObject(&fields, "", line); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func flattenObject(fields *[]field, prefix string, object []byte) error {
+	d := json.NewDecoder(bytes.NewReader(object))
+	d.UseNumber()
+	if t, err := d.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("log is not JSON object")
+	}
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		key := prefix + t.(string)
+		var raw json.RawMessage
+		if err := d.Decode(&raw); err != nil {
+			return err
+		}
+		switch raw[0] {
+		case '{':
+			if err := flattenObject(fields, key+".", raw); err != nil {
+				return err
+			}
+		case '"':
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return err
+			}
+			*fields = append(*fields, field{key, s})
+		case 'n':
+			*fields = append(*fields, field{key, ""})
+		default:
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, raw); err != nil {
+				return err
+			}
+			*fields = append(*fields, field{key, buf.String()})
+		}
+	}
+	return nil
+}
+
+// FormatLogfmt writes key=value pairs in the order of JSON fields.
+// Nested keys are joined with '.', e.g. peer.endpoint_ip=192.0.2.1
+func FormatLogfmt(line []byte) ([]byte, error) {
+	fields, err := flattenJSON(line)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		if f.Value == "" || strings.ContainsAny(f.Value, " =\"\\\t\r\n") {
+			buf.WriteString(strconv.Quote(f.Value))
+		} else {
+			buf.WriteString(f.Value)
+		}
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// severities are CEF and LEEF severities (0-10) of log levels.
+// Event logs have no level, and are treated as info.
+var severities = map[string]int{
+	"debug": 1,
+	"info":  3,
+	"warn":  6,
+	"error": 8,
+	"fatal": 10,
+	"panic": 10,
+}
+
+// siemEvent is the log mapped to common fields of CEF and LEEF.
+type siemEvent struct {
+	ID       string
+	Name     string
+	Severity int
+	Time     time.Time
+	User     string
+	Src      string
+	SrcPort  string
+	// Others are fields which are not mapped
+	Others []field
+}
+
+func newSIEMEvent(line []byte) (*siemEvent, error) {
+	fields, err := flattenJSON(line)
+	if err != nil {
+		return nil, err
+	}
+	e := &siemEvent{ID: "log", Severity: severities["info"]}
+	for _, f := range fields {
+		switch f.Key {
+		case "event":
+			e.ID = f.Value
+		case "message":
+			e.Name = f.Value
+		case "level":
+			if s, ok := severities[f.Value]; ok {
+				e.Severity = s
+			}
+		case "time":
+			if t, err := time.Parse(time.RFC3339Nano, f.Value); err == nil {
+				e.Time = t
+			}
+		case "friendly_name":
+			e.User = f.Value
+		case "peer.endpoint_ip":
+			if f.Value != "(none)" {
+				// IPv6 addresses are bracketed in endpoints
+				e.Src = strings.Trim(f.Value, "[]")
+			}
+		case "peer.endpoint":
+			if _, port, err := net.SplitHostPort(f.Value); err == nil {
+				e.SrcPort = port
+			}
+			e.Others = append(e.Others, f)
+		default:
+			e.Others = append(e.Others, f)
+		}
+	}
+	if e.Name == "" {
+		e.Name = e.ID
+	}
+	return e, nil
+}
+
+// extensionKey removes characters which are not allowed in keys of CEF and LEEF.
+func extensionKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// FormatCEF writes ArcSight Common Event Format.
+//
+//	CEF:0|livesense|wg-logger|<version>|<event>|<message>|<severity>|rt=... suser=... src=... spt=... msg=... <others>
+//
+// Unmapped fields are appended with their flattened keys, e.g. peer.public_key=...
+func FormatCEF(line []byte) ([]byte, error) {
+	e, err := newSIEMEvent(line)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		productVendor, productName, cefHeaderEscaper.Replace(ProductVersion),
+		cefHeaderEscaper.Replace(e.ID), cefHeaderEscaper.Replace(e.Name), e.Severity)
+
+	n := 0
+	add := func(key string, value string) {
+		if value == "" {
+			return
+		}
+		if n > 0 {
+			buf.WriteByte(' ')
+		}
+		n++
+		buf.WriteString(extensionKey(key))
+		buf.WriteByte('=')
+		buf.WriteString(cefExtensionEscaper.Replace(value))
+	}
+	if !e.Time.IsZero() {
+		add("rt", strconv.FormatInt(e.Time.UnixNano()/int64(time.Millisecond), 10))
+	}
+	add("suser", e.User)
+	add("src", e.Src)
+	add("spt", e.SrcPort)
+	add("msg", e.Name)
+	for _, f := range e.Others {
+		add(f.Key, f.Value)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+var (
+	leefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	leefAttributeEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\r", `\r`, "\n", `\n`)
+)
+
+// leefTimeFormat is the default format of devTime.
+const leefTimeFormat = "Jan 02 2006 15:04:05.000 MST"
+
+// FormatLEEF writes IBM QRadar Log Event Extended Format 2.0, attributes are separated by tab.
+//
+//	LEEF:2.0|livesense|wg-logger|<version>|<event>|x09|devTime=...	sev=...	cat=...	usrName=...	src=...	srcPort=...	msg=...	<others>
+//
+// Unmapped fields are appended with their flattened keys, e.g. peer.public_key=...
+func FormatLEEF(line []byte) ([]byte, error) {
+	e, err := newSIEMEvent(line)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "LEEF:2.0|%s|%s|%s|%s|x09|",
+		productVendor, productName, leefHeaderEscaper.Replace(ProductVersion), leefHeaderEscaper.Replace(e.ID))
+
+	n := 0
+	add := func(key string, value string) {
+		if value == "" {
+			return
+		}
+		if n > 0 {
+			buf.WriteByte('\t')
+		}
+		n++
+		buf.WriteString(extensionKey(key))
+		buf.WriteByte('=')
+		buf.WriteString(leefAttributeEscaper.Replace(value))
+	}
+	if !e.Time.IsZero() {
+		add("devTime", e.Time.Format(leefTimeFormat))
+	}
+	add("sev", strconv.Itoa(e.Severity))
+	add("cat", e.ID)
+	add("usrName", e.User)
+	add("src", e.Src)
+	add("srcPort", e.SrcPort)
+	add("msg", e.Name)
+	for _, f := range e.Others {
+		add(f.Key, f.Value)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update golden files in test/format")
+
+func TestFormats(t *testing.T) {
+	input, err := os.ReadFile("../../test/format/events.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ProductVersion = "1.0.0"
+	defer func() { ProductVersion = "dev" }()
+
+	for _, name := range []string{"logfmt", "cef", "leef"} {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			for _, line := range bytes.Split(bytes.TrimSpace(input), []byte("\n")) {
+				formatted, err := Formats[name](line)
+				if err != nil {
+					t.Fatal(err)
+				}
+				out.Write(formatted)
+			}
+
+			golden := "../../test/format/events." + name
+			if *update {
+				if err := os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, string(want), out.String())
+		})
+	}
+}
+
+func TestFormats_Invalid(t *testing.T) {
+	for name, format := range Formats {
+		if name == "json" {
+			continue
+		}
+		_, err := format([]byte(`["not", "object"]`))
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,189 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// gelfChunkSize is the maximum size of UDP datagrams, suitable for WAN
+	gelfChunkSize = 1420
+	// gelfMaxChunks is the limit of the number of chunks in GELF
+	gelfMaxChunks = 128
+)
+
+// gelfLevels are syslog severities of zerolog levels
+var gelfLevels = map[string]int{
+	"panic": 0,
+	"fatal": 2,
+	"error": 3,
+	"warn":  4,
+	"info":  6,
+	"debug": 7,
+}
+
+// gelfSender sends logs in GELF 1.1, over chunked and compressed UDP, or null-byte delimited TCP.
+type gelfSender struct {
+	network string
+	address string
+	host    string
+	timeout time.Duration
+	conn    net.Conn
+}
+
+func newGELFSender(network string, address string, timeout time.Duration) *gelfSender {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "wg-logger"
+	}
+	return &gelfSender{network: network, address: address, host: host, timeout: timeout}
+}
+
+// flattenGELF adds nested fields as additional fields, e.g. '_peer_public_key'.
+func flattenGELF(msg map[string]interface{}, prefix string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			flattenGELF(msg, prefix+"_"+k, item)
+		}
+	case json.Number:
+		msg[prefix] = v
+	case string:
+		msg[prefix] = v
+	case nil:
+	default:
+		// arrays and booleans are not allowed as values
+		b, _ := json.Marshal(v)
+		msg[prefix] = string(b)
+	}
+}
+
+// encodeGELFMessage converts a JSON log into GELF message.
+func encodeGELFMessage(host string, line []byte) ([]byte, error) {
+	record, err := decodeJSON(line)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := map[string]interface{}{
+		"version": "1.1",
+		"host":    host,
+		"level":   gelfLevels["info"],
+	}
+	for k, v := range record {
+		switch k {
+		case "message":
+			msg["short_message"] = v
+		case "time":
+			if s, ok := v.(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					msg["timestamp"] = json.Number(fmt.Sprintf("%d.%03d", t.Unix(), t.Nanosecond()/int(time.Millisecond)))
+				}
+			}
+		case "level":
+			if s, ok := v.(string); ok {
+				if l, ok := gelfLevels[s]; ok {
+					msg["level"] = l
+				}
+			}
+		case "id":
+			// '_id' is reserved
+			flattenGELF(msg, "_log_id", v)
+		default:
+			flattenGELF(msg, "_"+k, v)
+		}
+	}
+	if s, _ := msg["short_message"].(string); s == "" {
+		// short_message is required
+		msg["short_message"] = "-"
+		if event, ok := record["event"].(string); ok {
+			msg["short_message"] = event
+		}
+	}
+	return json.Marshal(msg)
+}
+
+// gelfChunks splits a compressed message into chunks with the header:
+// magic bytes 0x1e 0x0f, 8 bytes message id, sequence number and count.
+func gelfChunks(msg []byte) ([][]byte, error) {
+	if len(msg) <= gelfChunkSize {
+		return [][]byte{msg}, nil
+	}
+	const headerSize = 12
+	size := gelfChunkSize - headerSize
+	count := (len(msg) + size - 1) / size
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("GELF message is too large, %d bytes", len(msg))
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk := append([]byte{0x1e, 0x0f}, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, msg[i*size:end]...))
+	}
+	return chunks, nil
+}
+
+func (g *gelfSender) Send(line []byte) error {
+	msg, err := encodeGELFMessage(g.host, line)
+	if err != nil {
+		return permanent(err)
+	}
+
+	var packets [][]byte
+	if strings.HasPrefix(g.network, "udp") {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(msg)
+		if err = zw.Close(); err != nil {
+			return err
+		}
+		if packets, err = gelfChunks(buf.Bytes()); err != nil {
+			return permanent(err)
+		}
+	} else {
+		packets = [][]byte{append(msg, 0)}
+	}
+
+	if g.conn == nil {
+		if g.conn, err = net.DialTimeout(g.network, g.address, g.timeout); err != nil {
+			g.conn = nil
+			return err
+		}
+	}
+	if err = g.conn.SetWriteDeadline(time.Now().Add(g.timeout)); err == nil {
+		for _, p := range packets {
+			if _, err = g.conn.Write(p); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		g.conn.Close()
+		g.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (g *gelfSender) Close() error {
+	if g.conn == nil {
+		return nil
+	}
+	return g.conn.Close()
+}
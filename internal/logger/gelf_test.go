@@ -0,0 +1,132 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const gelfTestLine = `{"level":"warn","event":"suspected inactive","friendly_name":"1st person","labels":{"team":"infra"},"peer":{"public_key":"i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=","transfer_rx":1024,"allowed_ips":["10.0.0.1/32"]},"time":"2020-09-24T18:12:58.5+09:00","message":"last handshake was 30 minutes ago."}`
+
+func TestEncodeGELFMessage(t *testing.T) {
+	b, err := encodeGELFMessage("vpn01", []byte(gelfTestLine))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var msg map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &msg))
+	assert.Equal(t, map[string]interface{}{
+		"version":           "1.1",
+		"host":              "vpn01",
+		"short_message":     "last handshake was 30 minutes ago.",
+		"timestamp":         1600938778.5,
+		"level":             float64(4),
+		"_event":            "suspected inactive",
+		"_friendly_name":    "1st person",
+		"_labels_team":      "infra",
+		"_peer_public_key":  "i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=",
+		"_peer_transfer_rx": float64(1024),
+		"_peer_allowed_ips": `["10.0.0.1/32"]`,
+	}, msg)
+
+	// short_message is required
+	b, err = encodeGELFMessage("vpn01", []byte(`{"event":"handshake"}`))
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"short_message":"handshake"`)
+}
+
+func TestGELFSender_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	g := newGELFSender("udp", conn.LocalAddr().String(), time.Second)
+	defer g.Close()
+
+	// large message is split into chunks, random string is not compressed well
+	b := make([]byte, 4000)
+	_, _ = rand.Read(b)
+	random := hex.EncodeToString(b)
+	line := strings.Replace(gelfTestLine, `"1st person"`, `"`+random+`"`, 1)
+	if !assert.NoError(t, g.Send([]byte(line))) {
+		return
+	}
+
+	var payload []byte
+	buf := make([]byte, 65536)
+	count := 1
+	for seq := 0; seq < count; seq++ {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if !assert.NoError(t, err) {
+			return
+		}
+		p := buf[:n]
+		assert.LessOrEqual(t, n, gelfChunkSize)
+		if bytes.HasPrefix(p, []byte{0x1e, 0x0f}) {
+			assert.Equal(t, seq, int(p[10]))
+			count = int(p[11])
+			p = p[12:]
+		}
+		payload = append(payload, p...)
+	}
+
+	assert.Greater(t, count, 1)
+
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if !assert.NoError(t, err) {
+		return
+	}
+	b, err = io.ReadAll(zr)
+	assert.NoError(t, err)
+	var msg map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &msg))
+	assert.Equal(t, random, msg["_friendly_name"])
+}
+
+func TestGELFSender_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ln.Close()
+	received := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := r.ReadString(0)
+			if err != nil {
+				return
+			}
+			received <- strings.TrimSuffix(msg, "\x00")
+		}
+	}()
+
+	g := newGELFSender("tcp", ln.Addr().String(), time.Second)
+	defer g.Close()
+	assert.NoError(t, g.Send([]byte(gelfTestLine)))
+	assert.NoError(t, g.Send([]byte(`{"message":"2nd"}`)))
+
+	var msg map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(<-received), &msg))
+	assert.Equal(t, "last handshake was 30 minutes ago.", msg["short_message"])
+	assert.NoError(t, json.Unmarshal([]byte(<-received), &msg))
+	assert.Equal(t, "2nd", msg["short_message"])
+}
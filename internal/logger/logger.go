@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"strings"
@@ -8,9 +10,9 @@ import (
 	"time"
 
 	"github.com/livesense-inc/wg-logger/internal/config"
+	"github.com/livesense-inc/wg-logger/internal/kvs"
 
 	"github.com/rs/zerolog"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 func getLogLevel(config *config.Config) (loglevel zerolog.Level) {
@@ -29,47 +31,287 @@ func getLogLevel(config *config.Config) (loglevel zerolog.Level) {
 	return
 }
 
-func NewFileLogger(config *config.Config) (*zerolog.Logger, *zerolog.Logger) {
-	stdLogLumberjack := &lumberjack.Logger{
-		Filename:  config.EventLogPath,
-		MaxSize:   config.LogMaxMB,   // megabytes
-		MaxAge:    config.LogMaxDays, // days
-		LocalTime: true,
-	}
-
-	errLogLumberjack := &lumberjack.Logger{
-		Filename:  config.DaemonLogPath,
-		MaxSize:   config.LogMaxMB,   // megabytes
-		MaxAge:    config.LogMaxDays, // days
-		LocalTime: true,
-	}
-
-	zerolog.SetGlobalLevel(getLogLevel(config))
-
-	loggerStd := zerolog.New(stdLogLumberjack).With().Timestamp().Logger()
-	loggerErr := zerolog.New(errLogLumberjack).With().Timestamp().Logger()
+// parseLevel returns the level of name, info by default
+func parseLevel(name string) zerolog.Level {
+	return getLogLevel(&config.Config{LogLevel: name})
+}
 
-	// rotate logs when SIGHUP received
+// rotateOnSIGHUP rotates logs when SIGHUP received
+func rotateOnSIGHUP(loggers ...*rotatingFile) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP)
 	go func() {
 		for {
 			<-c
-			_ = stdLogLumberjack.Rotate()
-			_ = errLogLumberjack.Rotate()
+			for _, l := range loggers {
+				_ = l.Rotate()
+			}
 		}
 	}()
+}
 
-	return &loggerStd, &loggerErr
+func rotatingWriters(config *config.Config) (io.Writer, io.Writer, error) {
+	stdLog, err := newRotatingFile(config.EventLogPath, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	errLog, err := newRotatingFile(config.DaemonLogPath, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rotateOnSIGHUP(stdLog, errLog)
+
+	return stdLog, errLog, nil
+}
+
+// formatWriter converts JSON lines written by zerolog into the format.
+type formatWriter struct {
+	w      io.Writer
+	format Format
+}
+
+func (f formatWriter) Write(p []byte) (int, error) {
+	line, err := f.format(p)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.w.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// formatEvents writes the event log in event_log_format.
+func formatEvents(config *config.Config, w io.Writer) io.Writer {
+	format, ok := Formats[strings.ToLower(config.EventLogFormat)]
+	if !ok || strings.EqualFold(config.EventLogFormat, "json") {
+		return w
+	}
+	return formatWriter{w: w, format: format}
+}
+
+// fileWriters returns writers of log files, and chains lines of the event log
+// with HMAC when event_log_hash_key_file is set.
+func fileWriters(config *config.Config) (io.Writer, io.Writer, error) {
+	outputStd, outputErr, err := rotatingWriters(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.EventLogHashKeyFile == "" {
+		return formatEvents(config, outputStd), outputErr, nil
+	}
+	key, err := ReadChainKey(config.EventLogHashKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	chained, err := newChainWriter(outputStd, key, config.EventLogPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot continue hash chain of '%s': %w", config.EventLogPath, err)
+	}
+	return chained, outputErr, nil
+}
+
+func consoleWriters() (io.Writer, io.Writer) {
+	return zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339},
+		zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+}
+
+func NewFileLogger(config *config.Config) (*zerolog.Logger, *zerolog.Logger, error) {
+	zerolog.SetGlobalLevel(getLogLevel(config))
+
+	outputStd, outputErr, err := fileWriters(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	loggerStd := zerolog.New(outputStd).With().Timestamp().Logger()
+	loggerErr := zerolog.New(outputErr).With().Timestamp().Logger()
+
+	return &loggerStd, &loggerErr, nil
 }
 
 func NewConsoleLogger(config *config.Config) (*zerolog.Logger, *zerolog.Logger) {
 	zerolog.SetGlobalLevel(getLogLevel(config))
 
-	outputStd := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
+	outputStd, outputErr := consoleWriters()
 	loggerStd := zerolog.New(outputStd).With().Timestamp().Logger()
-	outputErr := zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
 	loggerErr := zerolog.New(outputErr).With().Timestamp().Logger()
 
 	return &loggerStd, &loggerErr
 }
+
+// NewJSONLogger writes raw JSON lines to stdout (event) and stderr (daemon) for containers.
+// The 'stream' field distinguishes them when log collectors merge both outputs.
+// The event log is converted when event_log_format is not 'json'.
+func NewJSONLogger(config *config.Config) (*zerolog.Logger, *zerolog.Logger) {
+	zerolog.SetGlobalLevel(getLogLevel(config))
+
+	loggerStd := zerolog.New(formatEvents(config, os.Stdout)).With().Timestamp().Str("stream", StreamEvent).Logger()
+	loggerErr := zerolog.New(os.Stderr).With().Timestamp().Str("stream", StreamDaemon).Logger()
+
+	return &loggerStd, &loggerErr
+}
+
+// NewStdoutLogger writes the event log to stdout in event_log_format, and the daemon log
+// to stderr as text, for commands like replay whose output is piped to other tools.
+func NewStdoutLogger(config *config.Config) (*zerolog.Logger, *zerolog.Logger) {
+	zerolog.SetGlobalLevel(getLogLevel(config))
+
+	loggerStd := zerolog.New(formatEvents(config, os.Stdout)).With().Timestamp().Logger()
+	loggerErr := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).With().Timestamp().Logger()
+
+	return &loggerStd, &loggerErr
+}
+
+// Loggers are the event logger and the daemon logger.
+type Loggers struct {
+	Event  *zerolog.Logger
+	Daemon *zerolog.Logger
+	sinks  []*Sink
+	// waiting is the number of logs in the outbox at the last report
+	waiting map[string]int
+}
+
+// Close closes sinks. Logs waiting in the outbox are sent after the next start.
+func (l *Loggers) Close() error {
+	var err error
+	for _, s := range l.sinks {
+		if e := s.Close(); e != nil && err == nil {
+			err = fmt.Errorf("sink '%s': %w", s.Name, e)
+		}
+	}
+	return err
+}
+
+// ReportOutbox writes the queue depth of remote sinks to the daemon log,
+// while logs are waiting for delivery, and when all of them are delivered.
+// Logs dropped since the last report are written as an error.
+func (l *Loggers) ReportOutbox() {
+	for _, s := range l.sinks {
+		w, ok := s.Writer.(*remoteWriter)
+		if !ok {
+			continue
+		}
+		if n, err := w.Dropped(); n > 0 {
+			l.Daemon.Error().
+				Err(err).
+				Str("sink", s.Name).
+				Int("dropped", n).
+				Msgf("%d logs are dropped, sink '%s' does not accept them", n, s.Name)
+		}
+		depth, err := w.Status()
+		switch {
+		case depth > 0:
+			l.Daemon.Warn().
+				Err(err).
+				Str("sink", s.Name).
+				Int("queue_depth", depth).
+				Msgf("%d logs are waiting for delivery to sink '%s'", depth, s.Name)
+		case l.waiting[s.Name] > 0:
+			l.Daemon.Info().
+				Str("sink", s.Name).
+				Int("queue_depth", depth).
+				Msgf("all logs are delivered to sink '%s'", s.Name)
+		}
+		l.waiting[s.Name] = depth
+	}
+}
+
+// New returns loggers writing to log_output.
+// When sinks are configured, each log is also written to sinks of the stream which accept it.
+// Logs of remote sinks wait for delivery in the outbox of the store, so close loggers before it.
+func New(config *config.Config, store kvs.Store) (*Loggers, error) {
+	output := strings.ToLower(config.LogOutput)
+	if len(config.Sinks) == 0 {
+		var l Loggers
+		switch output {
+		case "file":
+			var err error
+			if l.Event, l.Daemon, err = NewFileLogger(config); err != nil {
+				return nil, err
+			}
+		case "json":
+			l.Event, l.Daemon = NewJSONLogger(config)
+		case "none":
+			nop := zerolog.Nop()
+			l.Event, l.Daemon = &nop, &nop
+		default:
+			l.Event, l.Daemon = NewConsoleLogger(config)
+		}
+		return &l, nil
+	}
+
+	zerolog.SetGlobalLevel(getLogLevel(config))
+
+	// errors are not written to the daemon log, which may be written to the failing sink
+	onError := func(sink *Sink, err error) {
+		fmt.Fprintf(os.Stderr, "wg-logger: sink '%s' failed: %v\n", sink.Name, err)
+	}
+	event := &Fanout{OnError: onError}
+	daemon := &Fanout{OnError: onError}
+
+	var outputStd, outputErr io.Writer
+	switch output {
+	case "file":
+		var err error
+		if outputStd, outputErr, err = fileWriters(config); err != nil {
+			return nil, err
+		}
+	case "json":
+		outputStd, outputErr = formatEvents(config, os.Stdout), os.Stderr
+	case "none":
+	default:
+		outputStd, outputErr = consoleWriters()
+	}
+	if outputStd != nil {
+		event.Sinks = append(event.Sinks, &Sink{Name: "log_output", Stream: StreamEvent, Level: zerolog.DebugLevel, Format: FormatJSON, Writer: levelWriter{nopCloser{outputStd}}})
+		daemon.Sinks = append(daemon.Sinks, &Sink{Name: "log_output", Stream: StreamDaemon, Level: zerolog.DebugLevel, Format: FormatJSON, Writer: levelWriter{nopCloser{outputErr}}})
+	}
+
+	l := &Loggers{waiting: make(map[string]int)}
+	var outbox *kvs.Outbox
+	for _, c := range config.Sinks {
+		if c.IsRemote() && outbox == nil {
+			if store == nil {
+				return nil, fmt.Errorf("database is required for remote sinks")
+			}
+			var err error
+			if outbox, err = kvs.NewOutbox(store); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var rotated []*rotatingFile
+	for _, c := range config.Sinks {
+		sink, err := NewSink(config, c, outbox, onError)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.sinks = append(l.sinks, sink)
+		if w, ok := sink.Writer.(levelWriter); ok {
+			if f, ok := w.Writer.(*rotatingFile); ok {
+				rotated = append(rotated, f)
+			}
+		}
+		if sink.Stream == StreamDaemon {
+			daemon.Sinks = append(daemon.Sinks, sink)
+		} else {
+			event.Sinks = append(event.Sinks, sink)
+		}
+	}
+	if len(rotated) > 0 {
+		rotateOnSIGHUP(rotated...)
+	}
+
+	loggerStd := zerolog.New(event).With().Timestamp()
+	loggerErr := zerolog.New(daemon).With().Timestamp()
+	if output == "json" {
+		loggerStd = loggerStd.Str("stream", StreamEvent)
+		loggerErr = loggerErr.Str("stream", StreamDaemon)
+	}
+	eventLogger, daemonLogger := loggerStd.Logger(), loggerErr.Logger()
+	l.Event, l.Daemon = &eventLogger, &daemonLogger
+	return l, nil
+}
@@ -0,0 +1,212 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// msgpackEncoder writes the subset of MessagePack which is needed to send
+// JSON logs with the Fluent forward protocol.
+type msgpackEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *msgpackEncoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+func (e *msgpackEncoder) writeHeader(code byte, v interface{}) {
+	e.buf.WriteByte(code)
+	_ = binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *msgpackEncoder) ArrayHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		e.writeHeader(0xdc, uint16(n))
+	default:
+		e.writeHeader(0xdd, uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) MapHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		e.writeHeader(0xde, uint16(n))
+	default:
+		e.writeHeader(0xdf, uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) String(s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		e.buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.writeHeader(0xd9, uint8(n))
+	case n <= math.MaxUint16:
+		e.writeHeader(0xda, uint16(n))
+	default:
+		e.writeHeader(0xdb, uint32(n))
+	}
+	e.buf.WriteString(s)
+}
+
+func (e *msgpackEncoder) Int(i int64) {
+	switch {
+	case i >= 0 && i < 128:
+		e.buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		e.buf.WriteByte(byte(i))
+	default:
+		e.writeHeader(0xd3, i)
+	}
+}
+
+func (e *msgpackEncoder) Float(f float64) {
+	e.writeHeader(0xcb, f)
+}
+
+// EventTime is the extension type 0 of Fluent forward protocol, time with nanoseconds.
+func (e *msgpackEncoder) EventTime(t time.Time) {
+	e.buf.Write([]byte{0xd7, 0x00})
+	_ = binary.Write(&e.buf, binary.BigEndian, uint32(t.Unix()))
+	_ = binary.Write(&e.buf, binary.BigEndian, uint32(t.Nanosecond()))
+}
+
+// Value writes a value decoded from JSON with json.Number.
+func (e *msgpackEncoder) Value(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		e.buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			e.buf.WriteByte(0xc3)
+		} else {
+			e.buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			e.Int(i)
+		} else if f, err := v.Float64(); err == nil {
+			e.Float(f)
+		} else {
+			return err
+		}
+	case string:
+		e.String(v)
+	case []interface{}:
+		e.ArrayHeader(len(v))
+		for _, item := range v {
+			if err := e.Value(item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		// sorted to make output stable
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.MapHeader(len(v))
+		for _, k := range keys {
+			e.String(k)
+			if err := e.Value(v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+	return nil
+}
+
+// decodeJSON decodes a JSON log keeping numbers as json.Number.
+func decodeJSON(line []byte) (map[string]interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(line))
+	d.UseNumber()
+	var record map[string]interface{}
+	if err := d.Decode(&record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// readMsgpackStringMap reads a map of strings, e.g. the ack response {"ack": "<chunk>"}.
+// Values of other types are skipped.
+func readMsgpackStringMap(r io.Reader) (map[string]string, error) {
+	var code [1]byte
+	if _, err := io.ReadFull(r, code[:]); err != nil {
+		return nil, err
+	}
+	var n int
+	switch {
+	case code[0]&0xf0 == 0x80:
+		n = int(code[0] & 0x0f)
+	case code[0] == 0xde:
+		var l uint16
+		if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+			return nil, err
+		}
+		n = int(l)
+	default:
+		return nil, fmt.Errorf("msgpack: map is expected, got 0x%02x", code[0])
+	}
+
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		k, err := readMsgpackString(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readMsgpackString(r)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func readMsgpackString(r io.Reader) (string, error) {
+	var code [1]byte
+	if _, err := io.ReadFull(r, code[:]); err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case code[0]&0xe0 == 0xa0:
+		n = int(code[0] & 0x1f)
+	case code[0] == 0xd9:
+		var l uint8
+		if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+			return "", err
+		}
+		n = int(l)
+	case code[0] == 0xda:
+		var l uint16
+		if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+			return "", err
+		}
+		n = int(l)
+	default:
+		return "", fmt.Errorf("msgpack: string is expected, got 0x%02x", code[0])
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
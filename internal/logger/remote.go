@@ -0,0 +1,209 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/kvs"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// remoteBatchSize is the number of logs read from the outbox at once
+	remoteBatchSize = 100
+	// remoteMinBackoff and remoteMaxBackoff are the range of intervals to retry
+	// while the server is unavailable, doubled on each failure
+	remoteMinBackoff = time.Second
+	remoteMaxBackoff = 5 * time.Minute
+)
+
+// sender delivers a log line to a remote server.
+type sender interface {
+	Send(line []byte) error
+	Close() error
+}
+
+// permanentError is the error of a log which the server never accepts, e.g. it is rejected or can not be encoded.
+// The log is dropped instead of retried, not to block the logs after it in the outbox queue.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// remoteWriter appends each log to the durable outbox queue, and sends them in background
+// not to block checking peers. Logs are removed from the queue after the server accepts them,
+// so they are delivered at least once, even across restarts.
+type remoteWriter struct {
+	sender sender
+	queue  *kvs.Queue
+	// max is the maximum number of logs in the queue, logs are dropped when it is full
+	max        int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	onError    func(error)
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	lastErr error
+	// dropped and dropErr are the number and the last error of logs dropped since the last report
+	dropped int
+	dropErr error
+}
+
+func newRemoteWriter(s sender, queue *kvs.Queue, max int, onError func(error)) *remoteWriter {
+	w := &remoteWriter{
+		sender:     s,
+		queue:      queue,
+		max:        max,
+		minBackoff: remoteMinBackoff,
+		maxBackoff: remoteMaxBackoff,
+		onError:    onError,
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *remoteWriter) run() {
+	defer close(w.done)
+	var backoff time.Duration
+	for {
+		err := w.deliver()
+		w.mu.Lock()
+		w.lastErr = err
+		w.mu.Unlock()
+
+		if err == nil {
+			backoff = 0
+			select {
+			case <-w.stop:
+				return
+			case <-w.wake:
+			}
+			continue
+		}
+
+		// new logs do not shorten the backoff, not to flood the unavailable server
+		backoff *= 2
+		if backoff < w.minBackoff {
+			backoff = w.minBackoff
+		}
+		if backoff > w.maxBackoff {
+			backoff = w.maxBackoff
+		}
+		if w.onError != nil {
+			w.onError(fmt.Errorf("%w, %d logs are waiting, retry in %s", err, w.queue.Len(), backoff))
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// deliver sends logs in the queue in order until it is empty.
+func (w *remoteWriter) deliver() error {
+	for {
+		messages, err := w.queue.Peek(remoteBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+		for _, m := range messages {
+			if err = w.sender.Send(m.Data); err != nil {
+				var perr *permanentError
+				if !errors.As(err, &perr) {
+					return err
+				}
+				w.drop(err)
+			}
+			if err = w.queue.Ack(m.ID); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *remoteWriter) drop(err error) {
+	w.mu.Lock()
+	w.dropped++
+	w.dropErr = err
+	w.mu.Unlock()
+	if w.onError != nil {
+		w.onError(fmt.Errorf("%w, log is dropped", err))
+	}
+}
+
+// Dropped returns the number and the last error of logs dropped since the last call.
+func (w *remoteWriter) Dropped() (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err = w.dropped, w.dropErr
+	w.dropped, w.dropErr = 0, nil
+	return
+}
+
+// Status returns the number of logs waiting for delivery, and the last error of delivery.
+func (w *remoteWriter) Status() (depth int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.queue.Len(), w.lastErr
+}
+
+func (w *remoteWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w *remoteWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, fmt.Errorf("sink is closed, log is dropped")
+	}
+	if w.queue.Len() >= w.max {
+		return 0, fmt.Errorf("%d logs are waiting, log is dropped", w.max)
+	}
+	if _, err := w.queue.Append(p); err != nil {
+		return 0, err
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// Close stops delivery. Logs in the queue are sent after the next start.
+func (w *remoteWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.stop)
+	}
+	w.mu.Unlock()
+	<-w.done
+	return w.sender.Close()
+}
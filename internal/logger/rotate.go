@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/config"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// rotatingFile is the log file rotated by lumberjack by size, and also at the start
+// of each calendar period when log_rotate is 'daily' or 'hourly'.
+type rotatingFile struct {
+	*lumberjack.Logger
+	period string
+	loc    *time.Location
+	now    func() time.Time
+
+	mu sync.Mutex
+	// next is the start of the next period, when the file is rotated
+	next time.Time
+}
+
+// newRotatingFile prepares the log file with log_file_mode and log_file_owner.
+// lumberjack creates rotated files with the mode and the owner of the current file.
+func newRotatingFile(path string, c *config.Config) (*rotatingFile, error) {
+	mode, err := config.ParseFileMode(c.LogFileMode)
+	if err != nil {
+		return nil, err
+	}
+	uid, gid, err := config.ParseOwner(c.LogFileOwner)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, mode)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return nil, err
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(path, uid, gid); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &rotatingFile{
+		Logger: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    c.LogMaxMB,   // megabytes
+			MaxAge:     c.LogMaxDays, // days
+			MaxBackups: c.LogMaxBackups,
+			LocalTime:  !c.LogRotateUTC,
+			Compress:   c.LogCompress,
+		},
+		period: strings.ToLower(c.LogRotate),
+		loc:    time.Local,
+		now:    time.Now,
+	}
+	if c.LogRotateUTC {
+		r.loc = time.UTC
+	}
+	// the file written in the previous period is rotated at the first write
+	if fi.Size() > 0 {
+		r.next = r.nextPeriod(fi.ModTime())
+	} else {
+		r.next = r.nextPeriod(r.now())
+	}
+	return r, nil
+}
+
+// nextPeriod returns the start of the period after t, or zero time when rotated by size only.
+func (r *rotatingFile) nextPeriod(t time.Time) time.Time {
+	t = t.In(r.loc)
+	switch r.period {
+	case "daily":
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, r.loc)
+	case "hourly":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, r.loc)
+	}
+	return time.Time{}
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	if !r.next.IsZero() {
+		if now := r.now(); !now.Before(r.next) {
+			r.next = r.nextPeriod(now)
+			if err := r.Logger.Rotate(); err != nil {
+				r.mu.Unlock()
+				return 0, err
+			}
+		}
+	}
+	r.mu.Unlock()
+	return r.Logger.Write(p)
+}
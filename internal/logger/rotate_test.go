@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wg.log")
+	c := config.GetDefault()
+	c.LogRotate = "daily"
+	c.LogRotateUTC = true
+	c.LogCompress = true
+	c.LogFileMode = "0640"
+
+	f, err := newRotatingFile(path, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	now := time.Date(2020, 9, 24, 23, 59, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	f.next = f.nextPeriod(now)
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+	w, err := newChainWriter(f, testChainKey, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte(`{"event":"a"}` + "\n"))
+	_, _ = w.Write([]byte(`{"event":"b"}` + "\n"))
+	now = now.Add(time.Minute)
+	_, _ = w.Write([]byte(`{"event":"c"}` + "\n"))
+	assert.Equal(t, time.Date(2020, 9, 26, 0, 0, 0, 0, time.UTC), f.next)
+
+	// rotated file is compressed in background
+	var files []string
+	assert.Eventually(t, func() bool {
+		files, err = LogFiles(path)
+		return err == nil && len(files) == 2 && strings.HasSuffix(files[0], ".log.gz")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	fi, err = os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+	b, _ := os.ReadFile(path)
+	assert.Contains(t, string(b), `"event":"c","seq":3`)
+
+	result, err := VerifyChain(files, testChainKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, result.Problems)
+	assert.Equal(t, 3, result.Lines)
+}
+
+func TestRotatingFile_NextPeriod(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	at := time.Date(2020, 9, 24, 17, 30, 0, 0, time.UTC)
+	nextTests := []struct {
+		Period string
+		Loc    *time.Location
+		Want   time.Time
+	}{
+		{"size", time.UTC, time.Time{}},
+		{"daily", time.UTC, time.Date(2020, 9, 25, 0, 0, 0, 0, time.UTC)},
+		{"daily", jst, time.Date(2020, 9, 26, 0, 0, 0, 0, jst)},
+		{"hourly", jst, time.Date(2020, 9, 25, 3, 0, 0, 0, jst)},
+	}
+	for _, tt := range nextTests {
+		r := &rotatingFile{period: tt.Period, loc: tt.Loc}
+		assert.True(t, tt.Want.Equal(r.nextPeriod(at)), "%s %s: %s", tt.Period, tt.Loc, r.nextPeriod(at))
+	}
+}
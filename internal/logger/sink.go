@@ -0,0 +1,228 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/config"
+	"github.com/livesense-inc/wg-logger/internal/kvs"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// StreamEvent is the wireguard event log
+	StreamEvent = "event"
+	// StreamDaemon is the wg-logger internal log
+	StreamDaemon = "daemon"
+)
+
+// Format converts a JSON line written by zerolog into the output format.
+type Format func(line []byte) ([]byte, error)
+
+// FormatJSON writes JSON lines as they are
+func FormatJSON(line []byte) ([]byte, error) {
+	return line, nil
+}
+
+// FormatConsole writes human readable text without color
+func FormatConsole(line []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zerolog.ConsoleWriter{Out: &buf, NoColor: true, TimeFormat: "2006-01-02T15:04:05Z07:00"}
+	if _, err := w.Write(line); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sink is an output of logs with filters.
+type Sink struct {
+	Name   string
+	Stream string
+	// Events are event names to write, nil means all events
+	Events map[string]bool
+	// Level is the minimum level. Logs without level are treated as info.
+	Level  zerolog.Level
+	Format Format
+	Writer zerolog.LevelWriter
+}
+
+// accept reports whether the log is written to the sink.
+func (s *Sink) accept(level zerolog.Level, event string) bool {
+	if level == zerolog.NoLevel {
+		level = zerolog.InfoLevel
+	}
+	if level < s.Level {
+		return false
+	}
+	return s.Events == nil || s.Events[event]
+}
+
+func (s *Sink) Close() error {
+	if c, ok := s.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Fanout is the writer of a logger, which writes each log to all sinks of the stream.
+type Fanout struct {
+	Sinks []*Sink
+	// OnError is called when a sink fails, not to stop writing to other sinks
+	OnError func(sink *Sink, err error)
+}
+
+func (f *Fanout) Write(p []byte) (int, error) {
+	return f.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (f *Fanout) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var event string
+	for _, s := range f.Sinks {
+		if s.Events != nil {
+			var fields struct {
+				Event string `json:"event"`
+			}
+			_ = json.Unmarshal(p, &fields)
+			event = fields.Event
+			break
+		}
+	}
+
+	for _, s := range f.Sinks {
+		if !s.accept(level, event) {
+			continue
+		}
+		line, err := s.Format(p)
+		if err == nil {
+			_, err = s.Writer.WriteLevel(level, line)
+		}
+		if err != nil && f.OnError != nil {
+			f.OnError(s, err)
+		}
+	}
+	return len(p), nil
+}
+
+// levelWriter adapts io.Writer which ignores levels.
+type levelWriter struct {
+	io.Writer
+}
+
+func (w levelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	return w.Write(p)
+}
+
+func (w levelWriter) Close() error {
+	if c, ok := w.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// NewSink opens the output of the sink config.
+// Files are rotated like log_output file. Logs of remote sinks are queued in outbox,
+// and onError is called when their delivery fails.
+func NewSink(global *config.Config, c config.SinkConfig, outbox *kvs.Outbox, onError func(*Sink, error)) (*Sink, error) {
+	sink := &Sink{
+		Name:   c.Name,
+		Stream: strings.ToLower(c.Stream),
+		Level:  parseLevel(c.Level),
+	}
+	if len(c.Events) > 0 {
+		sink.Events = make(map[string]bool, len(c.Events))
+		for _, e := range c.Events {
+			sink.Events[e] = true
+		}
+	}
+
+	format, ok := Formats[strings.ToLower(c.Format)]
+	if !ok && c.Format != "" {
+		return nil, fmt.Errorf("sink '%s': unknown format '%s'", c.Name, c.Format)
+	}
+	sink.Format = FormatJSON
+	if ok {
+		sink.Format = format
+	}
+
+	if c.IsRemote() {
+		switch strings.ToLower(c.Type) {
+		case "fluent", "gelf":
+			// senders convert JSON logs into records
+			if c.Format != "" && !strings.EqualFold(c.Format, "json") {
+				return nil, fmt.Errorf("sink '%s': format '%s' is not supported by %s sink", c.Name, c.Format, c.Type)
+			}
+		}
+		s, err := newSender(c)
+		if err != nil {
+			return nil, fmt.Errorf("sink '%s': %w", c.Name, err)
+		}
+		queue, err := outbox.Queue(c.Name)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("sink '%s': cannot open outbox: %w", c.Name, err)
+		}
+		sink.Writer = newRemoteWriter(s, queue, c.OutboxMax, func(err error) { onError(sink, err) })
+		return sink, nil
+	}
+
+	switch strings.ToLower(c.Type) {
+	case "file":
+		f, err := newRotatingFile(c.Path, global)
+		if err != nil {
+			return nil, fmt.Errorf("sink '%s': %w", c.Name, err)
+		}
+		sink.Writer = levelWriter{f}
+	case "stdout":
+		sink.Writer = levelWriter{nopCloser{os.Stdout}}
+	case "stderr":
+		sink.Writer = levelWriter{nopCloser{os.Stderr}}
+	case "syslog":
+		w, err := newSyslogWriter(c.Facility, c.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("sink '%s': %w", c.Name, err)
+		}
+		sink.Writer = w
+	default:
+		return nil, fmt.Errorf("sink '%s': unknown type '%s'", c.Name, c.Type)
+	}
+	return sink, nil
+}
+
+// newSender returns the sender of the remote sink.
+func newSender(c config.SinkConfig) (sender, error) {
+	timeout := time.Duration(c.Timeout) * time.Second
+	switch strings.ToLower(c.Type) {
+	case "webhook":
+		return newWebhookSender(c.URL, timeout), nil
+	case "syslog":
+		return newSyslogSender(c.Address, c.Facility, c.Tag)
+	}
+
+	u, err := url.Parse(c.Address)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(c.Type) {
+	case "fluent":
+		address := u.Host
+		if u.Scheme == "unix" {
+			address = u.Path
+		}
+		return newFluentSender(u.Scheme, address, c.Tag, timeout), nil
+	case "gelf":
+		return newGELFSender(u.Scheme, u.Host, timeout), nil
+	}
+	return nil, fmt.Errorf("unknown type '%s'", c.Type)
+}
+
+// nopCloser keeps stdout and stderr open when sinks are closed.
+type nopCloser struct {
+	io.Writer
+}
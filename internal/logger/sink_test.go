@@ -0,0 +1,223 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/config"
+	"github.com/livesense-inc/wg-logger/internal/kvs"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanout(t *testing.T) {
+	var all, security, warn bytes.Buffer
+	fanout := &Fanout{Sinks: []*Sink{
+		{Name: "all", Level: zerolog.DebugLevel, Format: FormatJSON, Writer: levelWriter{&all}},
+		{Name: "security", Events: map[string]bool{"endpoint_ip updated": true}, Level: zerolog.DebugLevel, Format: FormatConsole, Writer: levelWriter{&security}},
+		{Name: "warn", Level: zerolog.WarnLevel, Format: FormatJSON, Writer: levelWriter{&warn}},
+	}}
+	logger := zerolog.New(fanout)
+
+	logger.Log().Str("event", "handshake").Msg("status update")
+	logger.Log().Str("event", "endpoint_ip updated").Msg("status update")
+	logger.Warn().Msg("wg-logger start")
+
+	assert.Equal(t, `{"event":"handshake","message":"status update"}
+{"event":"endpoint_ip updated","message":"status update"}
+{"level":"warn","message":"wg-logger start"}
+`, all.String())
+	assert.Equal(t, "<nil> ??? status update event=\"endpoint_ip updated\"\n", security.String())
+	assert.Equal(t, `{"level":"warn","message":"wg-logger start"}
+`, warn.String())
+}
+
+func openTestStore(t *testing.T) kvs.Store {
+	store, err := kvs.OpenStore("bbolt", filepath.Join(t.TempDir(), "wg-logger.db"), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func openTestQueue(t *testing.T, store kvs.Store, name string) *kvs.Queue {
+	outbox, err := kvs.NewOutbox(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue, err := outbox.Queue(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return queue
+}
+
+// testWebhook is the webhook server which is unavailable until up is set.
+type testWebhook struct {
+	*httptest.Server
+	mu       sync.Mutex
+	up       bool
+	received []string
+}
+
+func newTestWebhook(t *testing.T) *testWebhook {
+	h := &testWebhook{}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if !h.up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		h.received = append(h.received, string(body))
+	}))
+	t.Cleanup(h.Close)
+	return h
+}
+
+func (h *testWebhook) setUp(up bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.up = up
+}
+
+func (h *testWebhook) Received() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.received...)
+}
+
+func TestRemoteWriter_Webhook(t *testing.T) {
+	server := newTestWebhook(t)
+	queue := openTestQueue(t, openTestStore(t), "webhook")
+
+	var mu sync.Mutex
+	var errs []string
+	w := newRemoteWriter(newWebhookSender(server.URL, time.Second), queue, 100, func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err.Error())
+	})
+	w.minBackoff = 10 * time.Millisecond
+	w.maxBackoff = 20 * time.Millisecond
+	logger := zerolog.New(w)
+
+	logger.Log().Str("event", "handshake").Msg("1st")
+	logger.Log().Str("event", "handshake").Msg("2nd")
+	assert.Eventually(t, func() bool {
+		depth, err := w.Status()
+		return depth == 2 && err != nil
+	}, time.Second, 5*time.Millisecond)
+
+	server.setUp(true)
+	logger.Log().Str("event", "handshake").Msg("3rd")
+	assert.Eventually(t, func() bool { return len(server.Received()) == 3 }, time.Second, 5*time.Millisecond)
+	assert.NoError(t, w.Close())
+
+	// queued logs are sent in order
+	assert.Equal(t, []string{
+		`{"event":"handshake","message":"1st"}` + "\n",
+		`{"event":"handshake","message":"2nd"}` + "\n",
+		`{"event":"handshake","message":"3rd"}` + "\n",
+	}, server.Received())
+	assert.Equal(t, 0, queue.Len())
+	mu.Lock()
+	assert.Contains(t, errs[0], "unexpected status '503 Service Unavailable', ")
+	assert.Contains(t, errs[0], " logs are waiting, retry in 10ms")
+	mu.Unlock()
+
+	_, err := w.Write([]byte("{}\n"))
+	assert.Error(t, err)
+}
+
+func TestRemoteWriter_Rejected(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	queue := openTestQueue(t, openTestStore(t), "webhook")
+
+	var errs []string
+	w := newRemoteWriter(newWebhookSender(server.URL, time.Second), queue, 100, func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err.Error())
+	})
+	logger := zerolog.New(w)
+	logger.Log().Msg("1st")
+	logger.Log().Msg("2nd")
+
+	// rejected logs are dropped without retry
+	assert.Eventually(t, func() bool {
+		depth, err := w.Status()
+		return depth == 0 && err == nil
+	}, time.Second, 5*time.Millisecond)
+	n, err := w.Dropped()
+	assert.Equal(t, 2, n)
+	assert.EqualError(t, err, "unexpected status '400 Bad Request'")
+	n, _ = w.Dropped()
+	assert.Equal(t, 0, n)
+	assert.NoError(t, w.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, []string{
+		"unexpected status '400 Bad Request', log is dropped",
+		"unexpected status '400 Bad Request', log is dropped",
+	}, errs)
+}
+
+func TestNewSink_RemoteFormat(t *testing.T) {
+	outbox, err := kvs.NewOutbox(openTestStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{"fluent", "gelf"} {
+		c := config.SinkDefault()
+		c.Name, c.Type, c.Address, c.Format = typ, typ, "tcp://127.0.0.1:24224", "logfmt"
+		_, err := NewSink(config.GetDefault(), c, outbox, nil)
+		assert.EqualError(t, err, "sink '"+typ+"': format 'logfmt' is not supported by "+typ+" sink")
+
+		c.Format = "json"
+		sink, err := NewSink(config.GetDefault(), c, outbox, nil)
+		if assert.NoError(t, err) {
+			assert.NoError(t, sink.Close())
+		}
+	}
+}
+
+func TestRemoteWriter_Restart(t *testing.T) {
+	server := newTestWebhook(t)
+	store := openTestStore(t)
+
+	w := newRemoteWriter(newWebhookSender(server.URL, time.Second), openTestQueue(t, store, "webhook"), 2, nil)
+	logger := zerolog.New(w)
+	logger.Log().Msg("1st")
+	logger.Log().Msg("2nd")
+	// the queue is full
+	_, err := w.Write([]byte(`{"message":"3rd"}` + "\n"))
+	assert.EqualError(t, err, "2 logs are waiting, log is dropped")
+	assert.NoError(t, w.Close())
+	assert.Empty(t, server.Received())
+
+	// logs in the outbox are sent after restart
+	server.setUp(true)
+	w = newRemoteWriter(newWebhookSender(server.URL, time.Second), openTestQueue(t, store, "webhook"), 2, nil)
+	assert.Eventually(t, func() bool { return len(server.Received()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, []string{`{"message":"1st"}` + "\n", `{"message":"2nd"}` + "\n"}, server.Received())
+}
@@ -0,0 +1,136 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// syslogWriter writes logs with the severity of their levels.
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+// newSyslogWriter connects to local syslog.
+func newSyslogWriter(facility string, tag string) (*syslogWriter, error) {
+	priority, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility '%s'", facility)
+	}
+	w, err := syslog.Dial("", "", priority|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{w: w}, nil
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (s *syslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+	var err error
+	switch level {
+	case zerolog.DebugLevel:
+		err = s.w.Debug(msg)
+	case zerolog.WarnLevel:
+		err = s.w.Warning(msg)
+	case zerolog.ErrorLevel:
+		err = s.w.Err(msg)
+	case zerolog.FatalLevel:
+		err = s.w.Crit(msg)
+	case zerolog.PanicLevel:
+		err = s.w.Emerg(msg)
+	default:
+		err = s.w.Info(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *syslogWriter) Close() error {
+	return s.w.Close()
+}
+
+// syslogSender sends logs to remote syslog server like 'tcp://localhost:514' through the outbox.
+// The severity is taken from 'level' field of the log.
+type syslogSender struct {
+	network  string
+	raddr    string
+	priority syslog.Priority
+	tag      string
+	w        *syslogWriter
+}
+
+func newSyslogSender(address string, facility string, tag string) (*syslogSender, error) {
+	priority, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility '%s'", facility)
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSender{network: u.Scheme, raddr: u.Host, priority: priority, tag: tag}, nil
+}
+
+func (s *syslogSender) Send(line []byte) error {
+	if s.w == nil {
+		// connect lazily, the server may be unavailable at start
+		w, err := syslog.Dial(s.network, s.raddr, s.priority|syslog.LOG_INFO, s.tag)
+		if err != nil {
+			return err
+		}
+		s.w = &syslogWriter{w: w}
+	}
+	level := zerolog.NoLevel
+	var fields struct {
+		Level string `json:"level"`
+	}
+	if json.Unmarshal(line, &fields) == nil && fields.Level != "" {
+		level = parseLevel(fields.Level)
+	}
+	if _, err := s.w.WriteLevel(level, line); err != nil {
+		s.w.Close()
+		s.w = nil
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSender) Close() error {
+	if s.w == nil {
+		return nil
+	}
+	return s.w.Close()
+}
@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// webhookSender sends each log as a POST request.
+type webhookSender struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookSender(url string, timeout time.Duration) *webhookSender {
+	return &webhookSender{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (w *webhookSender) Send(line []byte) error {
+	res, err := w.client.Post(w.url, "application/json", bytes.NewReader(line))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		err = fmt.Errorf("unexpected status '%s'", res.Status)
+		if res.StatusCode >= 400 && res.StatusCode < 500 &&
+			res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+			// the server rejects the log itself
+			return permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (w *webhookSender) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,98 @@
+package peerdir
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// publicKeyPlaceholder in URL is replaced with each public key
+const publicKeyPlaceholder = "{public_key}"
+
+// HTTP is the provider which requests an inventory HTTP service.
+//
+// When URL contains '{public_key}', a request is sent for each peer and
+// the response must be an Entry object (404 means not found).
+// Otherwise the response must be an array of Entry for all peers.
+type HTTP struct {
+	URL         string
+	BearerToken string
+	Client      *http.Client
+}
+
+func NewHTTP(rawURL string, bearerToken string, timeout time.Duration) (*HTTP, error) {
+	u, err := url.Parse(strings.Replace(rawURL, publicKeyPlaceholder, "x", -1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid peer directory url '%s'", rawURL)
+	}
+	return &HTTP{
+		URL:         rawURL,
+		BearerToken: bearerToken,
+		Client:      &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (h *HTTP) String() string {
+	return h.URL
+}
+
+func (h *HTTP) get(rawURL string, v interface{}) (found bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/json")
+	if h.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+h.BearerToken)
+	}
+
+	res, err := h.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return false, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status '%s'", res.Status)
+	}
+	if err = json.NewDecoder(res.Body).Decode(v); err != nil {
+		return false, fmt.Errorf("invalid response: %w", err)
+	}
+	return true, nil
+}
+
+func (h *HTTP) Lookup(publicKeys []string) (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+
+	if !strings.Contains(h.URL, publicKeyPlaceholder) {
+		var list []Entry
+		if _, err := h.get(h.URL, &list); err != nil {
+			return nil, err
+		}
+		for _, e := range list {
+			entries[e.PublicKey] = e
+		}
+		return entries, nil
+	}
+
+	for _, key := range publicKeys {
+		var e Entry
+		found, err := h.get(strings.Replace(h.URL, publicKeyPlaceholder, url.QueryEscape(key), -1), &e)
+		if err != nil {
+			return entries, err
+		}
+		if found {
+			e.PublicKey = key
+			entries[key] = e
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,108 @@
+package peerdir
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAP is the provider which searches LDAP directory for entries with public keys.
+type LDAP struct {
+	URL          string
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// Filter narrows down entries, e.g. '(objectClass=person)'
+	Filter string
+	// Attributes maps the attribute names in LDAP directory
+	PublicKeyAttribute string
+	NameAttribute      string
+	OwnerAttribute     string
+	EmailAttribute     string
+	TeamAttribute      string
+	Timeout            time.Duration
+}
+
+func (l *LDAP) String() string {
+	return l.URL
+}
+
+// searchFilter returns the filter to find entries with any of public keys.
+func (l *LDAP) searchFilter(publicKeys []string) string {
+	var keys strings.Builder
+	for _, key := range publicKeys {
+		keys.WriteString(fmt.Sprintf("(%s=%s)", l.PublicKeyAttribute, ldap.EscapeFilter(key)))
+	}
+	filter := l.Filter
+	if filter == "" {
+		filter = "(objectClass=*)"
+	}
+	return fmt.Sprintf("(&%s(|%s))", filter, keys.String())
+}
+
+func (l *LDAP) Lookup(publicKeys []string) (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+	if len(publicKeys) == 0 {
+		return entries, nil
+	}
+
+	conn, err := ldap.DialURL(l.URL, ldap.DialWithDialer(&net.Dialer{Timeout: l.Timeout}))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetTimeout(l.Timeout)
+
+	if l.BindDN != "" {
+		if err = conn.Bind(l.BindDN, l.BindPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	var attributes []string
+	for _, a := range []string{l.PublicKeyAttribute, l.NameAttribute, l.OwnerAttribute, l.EmailAttribute, l.TeamAttribute} {
+		if a != "" {
+			attributes = append(attributes, a)
+		}
+	}
+	res, err := conn.Search(ldap.NewSearchRequest(
+		l.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(l.Timeout.Seconds()), false,
+		l.searchFilter(publicKeys),
+		attributes,
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	get := func(e *ldap.Entry, attribute string) string {
+		if attribute == "" {
+			return ""
+		}
+		return e.GetAttributeValue(attribute)
+	}
+	wanted := make(map[string]bool, len(publicKeys))
+	for _, key := range publicKeys {
+		wanted[key] = true
+	}
+	for _, e := range res.Entries {
+		// an entry may have multiple public keys (devices)
+		for _, key := range e.GetAttributeValues(l.PublicKeyAttribute) {
+			if !wanted[key] {
+				continue
+			}
+			entries[key] = Entry{
+				PublicKey: key,
+				Name:      get(e, l.NameAttribute),
+				Owner:     get(e, l.OwnerAttribute),
+				Email:     get(e, l.EmailAttribute),
+				Team:      get(e, l.TeamAttribute),
+			}
+		}
+	}
+	return entries, nil
+}
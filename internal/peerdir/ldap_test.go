@@ -0,0 +1,177 @@
+package peerdir
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// ldapStandIn is a minimal LDAP server which answers bind and search requests.
+type ldapStandIn struct {
+	listener net.Listener
+	entries  []map[string][]string
+	binds    []string
+	filters  []string
+}
+
+func newLDAPStandIn(t *testing.T, entries []map[string][]string) *ldapStandIn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &ldapStandIn{listener: l, entries: entries}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *ldapStandIn) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func ldapResult(id int64, op ber.Tag) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	r := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, "Result")
+	r.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(ldap.LDAPResultSuccess), "resultCode"))
+	r.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	r.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	p.AppendChild(r)
+	return p
+}
+
+func (s *ldapStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		req, err := ber.ReadPacket(conn)
+		if err != nil || len(req.Children) < 2 {
+			return
+		}
+		id := req.Children[0].Value.(int64)
+		op := req.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			s.binds = append(s.binds, op.Children[1].Value.(string))
+			_, _ = conn.Write(ldapResult(id, ldap.ApplicationBindResponse).Bytes())
+		case ldap.ApplicationSearchRequest:
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			s.filters = append(s.filters, filter)
+			for _, e := range s.entries {
+				matched := false
+				for _, key := range e["wireguardPublicKey"] {
+					matched = matched || strings.Contains(filter, "(wireguardPublicKey="+ldap.EscapeFilter(key)+")")
+				}
+				if !matched {
+					continue
+				}
+				p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+				p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+				r := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+				r.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "uid="+e["uid"][0]+",dc=example,dc=com", "objectName"))
+				attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+				for name, values := range e {
+					attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+					attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+					vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+					for _, v := range values {
+						vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+					}
+					attr.AppendChild(vals)
+					attrs.AppendChild(attr)
+				}
+				r.AppendChild(attrs)
+				p.AppendChild(r)
+				_, _ = conn.Write(p.Bytes())
+			}
+			_, _ = conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone).Bytes())
+		default:
+			// unbind
+			return
+		}
+	}
+}
+
+func TestLDAP_Lookup(t *testing.T) {
+	server := newLDAPStandIn(t, []map[string][]string{
+		{
+			"uid":                {"alice"},
+			"cn":                 {"Alice"},
+			"mail":               {"alice@example.com"},
+			"ou":                 {"infra"},
+			"wireguardPublicKey": {"i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=", "63clN7mNlJ7ckYH7VirX1VyAfXwR4t9DP9DRp2qMu0o="},
+		},
+		{
+			"uid":                {"bob"},
+			"cn":                 {"Bob"},
+			"wireguardPublicKey": {"bws0GsCPM0IT8OSgVirk6lgiRcOw6Ga3X62plId+PBU="},
+		},
+	})
+
+	l := &LDAP{
+		URL:                server.URL(),
+		BindDN:             "cn=wg-logger,dc=example,dc=com",
+		BindPassword:       "secret",
+		BaseDN:             "dc=example,dc=com",
+		Filter:             "(objectClass=person)",
+		PublicKeyAttribute: "wireguardPublicKey",
+		NameAttribute:      "cn",
+		OwnerAttribute:     "uid",
+		EmailAttribute:     "mail",
+		TeamAttribute:      "ou",
+		Timeout:            5 * time.Second,
+	}
+	entries, err := l.Lookup([]string{
+		"i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=",
+		"bws0GsCPM0IT8OSgVirk6lgiRcOw6Ga3X62plId+PBU=",
+		"NyPEExViZP/KuPYkYPNAqd6jo3xrfy8yBGSKrEaKPyI=",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]Entry{
+		"i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=": {
+			PublicKey: "i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=",
+			Name:      "Alice",
+			Owner:     "alice",
+			Email:     "alice@example.com",
+			Team:      "infra",
+		},
+		"bws0GsCPM0IT8OSgVirk6lgiRcOw6Ga3X62plId+PBU=": {
+			PublicKey: "bws0GsCPM0IT8OSgVirk6lgiRcOw6Ga3X62plId+PBU=",
+			Name:      "Bob",
+			Owner:     "bob",
+		},
+	}, entries)
+	assert.Equal(t, []string{"cn=wg-logger,dc=example,dc=com"}, server.binds)
+	if assert.Len(t, server.filters, 1) {
+		assert.Equal(t, "(&(objectClass=person)(|"+
+			"(wireguardPublicKey=i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=)"+
+			"(wireguardPublicKey=bws0GsCPM0IT8OSgVirk6lgiRcOw6Ga3X62plId+PBU=)"+
+			"(wireguardPublicKey=NyPEExViZP/KuPYkYPNAqd6jo3xrfy8yBGSKrEaKPyI=)))", server.filters[0])
+	}
+}
+
+func TestLDAP_Unavailable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	_, err = (&LDAP{URL: "ldap://" + addr, PublicKeyAttribute: "wireguardPublicKey", Timeout: time.Second}).Lookup([]string{"key1"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,223 @@
+package peerdir
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/wgconf"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// PrecedenceWGConf prefers names and labels in WireGuard config file (default)
+	PrecedenceWGConf = "wgconf"
+	// PrecedenceDirectory prefers names and labels in peer directory
+	PrecedenceDirectory = "directory"
+)
+
+// Entry is the information of a peer in peer directory.
+type Entry struct {
+	PublicKey string `json:"public_key" yaml:"public_key"`
+	Name      string `json:"name" yaml:"name"`
+	Owner     string `json:"owner" yaml:"owner"`
+	Email     string `json:"email" yaml:"email"`
+	Team      string `json:"team" yaml:"team"`
+}
+
+// Labels returns owner, email and team as labels.
+func (e Entry) Labels() wgconf.Labels {
+	labels := wgconf.Labels{}
+	for k, v := range map[string]string{"owner": e.Owner, "email": e.Email, "team": e.Team} {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// File is the peer directory file mapping public key to peer information.
+// The format is chosen by the extension: .csv, .json, .yaml or .yml
+type File struct {
+	// Path to peer directory file
+	Path string
+	// ModTime and Size are the stat of loaded file
+	ModTime time.Time
+	Size    int64
+
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+func NewFile(path string) (*File, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s is not found", path)
+	}
+	if _, err := decoderFor(path); err != nil {
+		return nil, err
+	}
+	return &File{Path: path}, nil
+}
+
+// Entries returns a map with peer's public key as key.
+// The file is reloaded when it is modified.
+func (f *File) Entries() (map[string]Entry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stat, err := os.Stat(f.Path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s is not found", f.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.entries != nil && stat.ModTime() == f.ModTime && stat.Size() == f.Size {
+		// return cache
+		return f.entries, nil
+	}
+
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	decode, err := decoderFor(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	list, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", f.Path, err)
+	}
+
+	entries := make(map[string]Entry)
+	for i, e := range list {
+		e.PublicKey = strings.TrimSpace(e.PublicKey)
+		if e.PublicKey == "" {
+			return nil, fmt.Errorf("cannot parse %s: entry #%d has no public_key", f.Path, i+1)
+		}
+		if _, ok := entries[e.PublicKey]; ok {
+			return nil, fmt.Errorf("cannot parse %s: duplicate public_key '%s'", f.Path, e.PublicKey)
+		}
+		entries[e.PublicKey] = e
+	}
+
+	f.ModTime = stat.ModTime()
+	f.Size = stat.Size()
+	f.entries = entries
+	return entries, nil
+}
+
+func decoderFor(path string) (func([]byte) ([]Entry, error), error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return decodeCSV, nil
+	case ".json":
+		return decodeJSON, nil
+	case ".yaml", ".yml":
+		return decodeYAML, nil
+	default:
+		return nil, fmt.Errorf("unsupported peer directory format '%s', use .csv, .json, .yaml or .yml", path)
+	}
+}
+
+func decodeJSON(data []byte) (entries []Entry, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&entries)
+	return
+}
+
+func decodeYAML(data []byte) (entries []Entry, err error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err = dec.Decode(&entries); err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// decodeCSV reads CSV with header row, e.g.
+//
+//	public_key,name,owner,email,team
+func decodeCSV(data []byte) (entries []Entry, err error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil || len(records) == 0 {
+		return
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "public_key", "name", "owner", "email", "team":
+		default:
+			return nil, fmt.Errorf("unknown column '%s'", name)
+		}
+	}
+	if _, ok := columns["public_key"]; !ok {
+		return nil, fmt.Errorf("'public_key' column is required")
+	}
+
+	get := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	for _, record := range records[1:] {
+		entries = append(entries, Entry{
+			PublicKey: get(record, "public_key"),
+			Name:      get(record, "name"),
+			Owner:     get(record, "owner"),
+			Email:     get(record, "email"),
+			Team:      get(record, "team"),
+		})
+	}
+	return
+}
+
+// Merge merges peer directory entries into names and labels from WireGuard config file.
+// With PrecedenceWGConf, the directory only fills names and labels not described in WireGuard config file.
+// With PrecedenceDirectory, the directory overrides them.
+func Merge(names map[string]string, labels map[string]wgconf.Labels, entries map[string]Entry, precedence string) (map[string]string, map[string]wgconf.Labels) {
+	mergedNames := make(map[string]string, len(names))
+	for k, v := range names {
+		mergedNames[k] = v
+	}
+	mergedLabels := make(map[string]wgconf.Labels, len(labels))
+	for k, v := range labels {
+		mergedLabels[k] = wgconf.Labels{}
+		for lk, lv := range v {
+			mergedLabels[k][lk] = lv
+		}
+	}
+
+	for key, e := range entries {
+		if name, ok := mergedNames[key]; e.Name != "" &&
+			(precedence == PrecedenceDirectory || !ok || name == "" || name == wgconf.NoName) {
+			mergedNames[key] = e.Name
+		}
+		for lk, lv := range e.Labels() {
+			if mergedLabels[key] == nil {
+				mergedLabels[key] = wgconf.Labels{}
+			}
+			if _, ok := mergedLabels[key][lk]; precedence == PrecedenceDirectory || !ok {
+				mergedLabels[key][lk] = lv
+			}
+		}
+	}
+	return mergedNames, mergedLabels
+}
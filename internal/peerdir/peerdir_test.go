@@ -0,0 +1,129 @@
+package peerdir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/wgconf"
+	"github.com/stretchr/testify/assert"
+)
+
+var wantEntries = map[string]Entry{
+	"i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=": {
+		PublicKey: "i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=",
+		Name:      "Alice laptop",
+		Owner:     "alice",
+		Email:     "alice@example.com",
+		Team:      "infra",
+	},
+	"bws0GsCPM0IT8OSgVirk6lgiRcOw6Ga3X62plId+PBU=": {
+		PublicKey: "bws0GsCPM0IT8OSgVirk6lgiRcOw6Ga3X62plId+PBU=",
+		Name:      "Bob phone",
+		Owner:     "bob",
+		Email:     "bob@example.com",
+	},
+}
+
+func TestFile_Entries(t *testing.T) {
+	for _, name := range []string{"peers.csv", "peers.json", "peers.yaml"} {
+		f, err := NewFile(filepath.Join("../../test", name))
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		entries, err := f.Entries()
+		assert.NoError(t, err, name)
+		assert.Equal(t, wantEntries, entries, name)
+	}
+
+	_, err := NewFile("../../test/wg0.conf")
+	assert.Error(t, err)
+	_, err = NewFile("../../test/not-found.yaml")
+	assert.Error(t, err)
+}
+
+func TestFile_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.csv")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("public_key,name\nkey1,first\n"), 0600))
+	f, err := NewFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	entries, err := f.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", entries["key1"].Name)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("public_key,name\nkey1,second\n"), 0600))
+	// keep the size and make modified time differ
+	assert.NoError(t, os.Chtimes(path, time.Now(), f.ModTime.Add(time.Second)))
+	entries, err = f.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, "second", entries["key1"].Name)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("public_key,name\nkey1,second\nkey1,third\n"), 0600))
+	_, err = f.Entries()
+	assert.Error(t, err)
+}
+
+func TestFile_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.csv")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("public_key,name\nkey1,first\n"), 0600))
+	f, err := NewFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entries, err := f.Entries()
+			assert.NoError(t, err)
+			assert.Equal(t, "first", entries["key1"].Name)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDecodeCSV_Invalid(t *testing.T) {
+	_, err := decodeCSV([]byte("name,owner\nfoo,bar\n"))
+	assert.Error(t, err)
+	_, err = decodeCSV([]byte("public_key,nickname\nkey1,foo\n"))
+	assert.Error(t, err)
+}
+
+func TestMerge(t *testing.T) {
+	names := map[string]string{
+		"key1": "name in wgconf",
+		"key2": wgconf.NoName,
+	}
+	labels := map[string]wgconf.Labels{
+		"key1": {"owner": "carol"},
+	}
+	entries := map[string]Entry{
+		"key1": {PublicKey: "key1", Name: "name in directory", Owner: "alice", Team: "infra"},
+		"key2": {PublicKey: "key2", Name: "bob", Owner: "bob"},
+		"key3": {PublicKey: "key3", Name: "dave"},
+	}
+
+	gotNames, gotLabels := Merge(names, labels, entries, PrecedenceWGConf)
+	assert.Equal(t, map[string]string{
+		"key1": "name in wgconf",
+		"key2": "bob",
+		"key3": "dave",
+	}, gotNames)
+	assert.Equal(t, wgconf.Labels{"owner": "carol", "team": "infra"}, gotLabels["key1"])
+	assert.Equal(t, wgconf.Labels{"owner": "bob"}, gotLabels["key2"])
+
+	gotNames, gotLabels = Merge(names, labels, entries, PrecedenceDirectory)
+	assert.Equal(t, "name in directory", gotNames["key1"])
+	assert.Equal(t, wgconf.Labels{"owner": "alice", "team": "infra"}, gotLabels["key1"])
+
+	// inputs are not modified
+	assert.Equal(t, "name in wgconf", names["key1"])
+	assert.Equal(t, wgconf.Labels{"owner": "carol"}, labels["key1"])
+}
@@ -0,0 +1,143 @@
+package peerdir
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/config"
+	"github.com/livesense-inc/wg-logger/internal/kvs"
+)
+
+const (
+	// ProviderFile reads a local CSV/JSON/YAML file (default)
+	ProviderFile = "file"
+	// ProviderLDAP searches LDAP directory
+	ProviderLDAP = "ldap"
+	// ProviderHTTP requests an inventory HTTP service returning JSON
+	ProviderHTTP = "http"
+)
+
+// Provider looks up peer information by public keys.
+type Provider interface {
+	// Lookup returns entries of peers found with public keys.
+	// Entries may be returned with error, when some of them are available.
+	Lookup(publicKeys []string) (map[string]Entry, error)
+	// String describes the provider for logging
+	String() string
+}
+
+func (f *File) Lookup(publicKeys []string) (map[string]Entry, error) {
+	return f.Entries()
+}
+
+func (f *File) String() string {
+	return f.Path
+}
+
+// Cached is the provider which caches entries of remote provider in the database.
+// While the provider is unavailable, stale entries are returned with error instead of losing names.
+type Cached struct {
+	Provider Provider
+	Cache    *kvs.TTLCache
+}
+
+func (c *Cached) String() string {
+	return c.Provider.String()
+}
+
+func (c *Cached) Lookup(publicKeys []string) (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+	var missing []string
+	for _, key := range publicKeys {
+		v, fresh, ok := c.Cache.Get(key)
+		var e Entry
+		if ok && json.Unmarshal(v, &e) == nil {
+			entries[key] = e
+			if fresh {
+				continue
+			}
+		}
+		missing = append(missing, key)
+	}
+	if len(missing) == 0 {
+		return entries, nil
+	}
+
+	found, err := c.Provider.Lookup(missing)
+	for _, key := range missing {
+		e, ok := found[key]
+		if !ok {
+			if err != nil {
+				// unknown whether the peer exists, keep the cached entry
+				continue
+			}
+			// peers not found are also cached, not to look up them every time
+			e = Entry{PublicKey: key}
+		}
+		entries[key] = e
+		v, err := json.Marshal(e)
+		if err != nil {
+			return entries, err
+		}
+		if err = c.Cache.Set(key, v); err != nil {
+			return entries, err
+		}
+	}
+	if err != nil {
+		return entries, fmt.Errorf("lookup in '%s' failed, cached entries are used: %w", c.Provider, err)
+	}
+	return entries, nil
+}
+
+// directoryBucket is the bucket name to cache entries of remote providers
+const directoryBucket = "directory"
+
+// NewProvider returns the provider selected in config, or nil when peer directory is disabled.
+// Entries of remote providers are cached in store.
+func NewProvider(config *config.Config, store kvs.Store) (Provider, error) {
+	var remote Provider
+	switch config.PeerDirectoryProvider {
+	case ProviderFile, "":
+		if config.PeerDirectory == "" {
+			return nil, nil
+		}
+		f, err := NewFile(config.PeerDirectory)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	case ProviderLDAP:
+		c := config.PeerDirectoryLDAP
+		if c.URL == "" || c.PublicKeyAttribute == "" {
+			return nil, fmt.Errorf("'url' and 'public_key_attribute' are required for ldap peer directory")
+		}
+		remote = &LDAP{
+			URL:                c.URL,
+			BindDN:             c.BindDN,
+			BindPassword:       c.BindPassword,
+			BaseDN:             c.BaseDN,
+			Filter:             c.Filter,
+			PublicKeyAttribute: c.PublicKeyAttribute,
+			NameAttribute:      c.NameAttribute,
+			OwnerAttribute:     c.OwnerAttribute,
+			EmailAttribute:     c.EmailAttribute,
+			TeamAttribute:      c.TeamAttribute,
+			Timeout:            time.Duration(c.Timeout) * time.Second,
+		}
+	case ProviderHTTP:
+		c := config.PeerDirectoryHTTP
+		h, err := NewHTTP(c.URL, c.BearerToken, time.Duration(c.Timeout)*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		remote = h
+	default:
+		return nil, fmt.Errorf("unknown peer directory provider '%s'", config.PeerDirectoryProvider)
+	}
+
+	return &Cached{
+		Provider: remote,
+		Cache:    kvs.NewTTLCache(store.WithBucket(directoryBucket), time.Duration(config.PeerDirectoryCacheTTL)*time.Second),
+	}, nil
+}
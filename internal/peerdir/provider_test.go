@@ -0,0 +1,180 @@
+package peerdir
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/config"
+	"github.com/livesense-inc/wg-logger/internal/kvs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTP_Lookup(t *testing.T) {
+	var auth []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		switch {
+		case r.URL.Path == "/peers":
+			fmt.Fprint(w, `[{"public_key":"key1","name":"Alice","owner":"alice"},{"public_key":"key2","name":"Bob"}]`)
+		case r.URL.Path == "/peers/key+1=":
+			fmt.Fprint(w, `{"name":"Alice","team":"infra"}`)
+		case strings.HasPrefix(r.URL.Path, "/peers/"):
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "error", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	h, err := NewHTTP(server.URL+"/peers", "token", time.Second)
+	if !assert.NoError(t, err) {
+		return
+	}
+	entries, err := h.Lookup([]string{"key1"})
+	assert.NoError(t, err)
+	assert.Equal(t, Entry{PublicKey: "key1", Name: "Alice", Owner: "alice"}, entries["key1"])
+	assert.Len(t, entries, 2)
+	assert.Equal(t, []string{"Bearer token"}, auth)
+
+	h, _ = NewHTTP(server.URL+"/peers/{public_key}", "", time.Second)
+	entries, err = h.Lookup([]string{"key+1=", "unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Entry{"key+1=": {PublicKey: "key+1=", Name: "Alice", Team: "infra"}}, entries)
+
+	h, _ = NewHTTP(server.URL+"/error", "", time.Second)
+	_, err = h.Lookup([]string{"key1"})
+	assert.Error(t, err)
+
+	_, err = NewHTTP("ftp://example.com/", "", time.Second)
+	assert.Error(t, err)
+}
+
+type stubProvider struct {
+	entries map[string]Entry
+	err     error
+	lookups [][]string
+}
+
+func (s *stubProvider) Lookup(publicKeys []string) (map[string]Entry, error) {
+	s.lookups = append(s.lookups, publicKeys)
+	return s.entries, s.err
+}
+
+func (s *stubProvider) String() string {
+	return "stub"
+}
+
+func TestCached_Lookup(t *testing.T) {
+	store, err := kvs.Open(filepath.Join(t.TempDir(), "cache.db"), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	stub := &stubProvider{entries: map[string]Entry{"key1": {PublicKey: "key1", Name: "Alice"}}}
+	cached := &Cached{Provider: stub, Cache: kvs.NewTTLCache(store.WithBucket(directoryBucket), time.Hour)}
+
+	entries, err := cached.Lookup([]string{"key1", "key2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", entries["key1"].Name)
+	assert.Equal(t, [][]string{{"key1", "key2"}}, stub.lookups)
+
+	// fresh entries, including not found, are served from cache
+	entries, err = cached.Lookup([]string{"key1", "key2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", entries["key1"].Name)
+	assert.Len(t, stub.lookups, 1)
+	// cache is not in the peer records bucket
+	assert.Nil(t, store.Get("key1"))
+
+	// expired entries are used while the provider is unavailable
+	stub.err = fmt.Errorf("connection refused")
+	cached.Cache.TTL = 0
+	entries, err = cached.Lookup([]string{"key1", "key3"})
+	assert.Error(t, err)
+	assert.Equal(t, map[string]Entry{"key1": {PublicKey: "key1", Name: "Alice"}}, entries)
+	assert.Equal(t, []string{"key1", "key3"}, stub.lookups[1])
+
+	// partial entries returned with error are used and cached
+	stub.entries = map[string]Entry{"key3": {PublicKey: "key3", Name: "Bob"}}
+	cached.Cache.TTL = time.Hour
+	entries, err = cached.Lookup([]string{"key3", "key4"})
+	assert.Error(t, err)
+	assert.Equal(t, map[string]Entry{"key3": {PublicKey: "key3", Name: "Bob"}}, entries)
+	stub.err = nil
+	entries, err = cached.Lookup([]string{"key3", "key4"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bob", entries["key3"].Name)
+	assert.Equal(t, []string{"key4"}, stub.lookups[3])
+}
+
+func TestNewProvider(t *testing.T) {
+	store, err := kvs.Open(filepath.Join(t.TempDir(), "cache.db"), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	conf := config.GetDefault()
+	p, err := NewProvider(conf, store)
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+
+	conf.PeerDirectory = "../../test/peers.yaml"
+	p, err = NewProvider(conf, store)
+	assert.NoError(t, err)
+	assert.IsType(t, &File{}, p)
+
+	conf.PeerDirectoryProvider = ProviderLDAP
+	conf.PeerDirectoryLDAP.URL = "ldap://127.0.0.1:389"
+	p, err = NewProvider(conf, store)
+	assert.NoError(t, err)
+	assert.IsType(t, &Cached{}, p)
+
+	conf.PeerDirectoryProvider = "nis"
+	_, err = NewProvider(conf, store)
+	assert.Error(t, err)
+}
+
+func TestNewProvider_MixedCase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wg-logger.conf")
+	content := fmt.Sprintf("database = %q\ndatabase_driver = \"SQLite\"\npeer_directory_provider = \"File\"\npeer_directory = \"../../test/peers.yaml\"\npeer_directory_precedence = \"Directory\"\n",
+		filepath.Join(dir, "wg-logger.db"))
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := config.GetConfig(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, conf.Set("peer_directory_provider", "FILE", config.SourceEnv))
+	for _, p := range conf.Validate() {
+		assert.False(t, strings.HasPrefix(p, "database") || strings.HasPrefix(p, "peer_directory"), p)
+	}
+
+	store, err := kvs.OpenStore(conf.DatabaseDriver, conf.Database, "main")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer store.Close()
+	assert.IsType(t, &kvs.SQLite{}, store)
+
+	p, err := NewProvider(conf, store)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.IsType(t, &File{}, p)
+
+	key := "i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA="
+	entries, err := p.Lookup([]string{key})
+	assert.NoError(t, err)
+	names, _ := Merge(map[string]string{key: "alice"}, nil, entries, conf.PeerDirectoryPrecedence)
+	assert.Equal(t, "Alice laptop", names[key])
+}
@@ -0,0 +1,89 @@
+package wgconf
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// annotationPrefix starts an annotation comment in [Peer] section, e.g.
+//
+//	# wg-logger: owner=alice team=infra device=laptop expires=2026-12-31
+const annotationPrefix = "wg-logger:"
+
+// labelNamePattern is same as Prometheus label names, so labels can be exposed as metric labels as they are.
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Labels are key=value annotations of a peer.
+type Labels map[string]string
+
+// Keys returns label names in sorted order.
+func (l Labels) Keys() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String returns labels in Prometheus format, e.g. {owner="alice",team="infra"}
+func (l Labels) String() string {
+	var pairs []string
+	for _, k := range l.Keys() {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, strconv.Quote(l[k])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (l Labels) MarshalZerologObject(e *zerolog.Event) {
+	for _, k := range l.Keys() {
+		e.Str(k, l[k])
+	}
+}
+
+// isAnnotation reports whether the comment text is an annotation.
+func isAnnotation(text string) bool {
+	return strings.HasPrefix(text, annotationPrefix)
+}
+
+// parseAnnotation parses 'wg-logger: key=value key="quoted value" ...'.
+func parseAnnotation(text string) (labels Labels, err error) {
+	labels = Labels{}
+	s := strings.TrimSpace(strings.TrimPrefix(text, annotationPrefix))
+	for s != "" {
+		i := strings.Index(s, "=")
+		if i <= 0 {
+			return labels, fmt.Errorf("invalid label '%s', want 'key=value'", strings.Fields(s)[0])
+		}
+		key := s[:i]
+		if !labelNamePattern.MatchString(key) || strings.HasPrefix(key, "__") {
+			return labels, fmt.Errorf("invalid label name '%s'", key)
+		}
+		s = s[i+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			// quoted value may contain spaces
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				return labels, fmt.Errorf("unterminated quoted value for label '%s'", key)
+			}
+			value = s[1 : end+1]
+			s = s[end+2:]
+		} else if end := strings.IndexAny(s, " \t"); end >= 0 {
+			value = s[:end]
+			s = s[end:]
+		} else {
+			value = s
+			s = ""
+		}
+		labels[key] = value
+		s = strings.TrimLeft(s, " \t")
+	}
+	return labels, nil
+}
@@ -0,0 +1,39 @@
+package wgconf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAnnotation(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Labels
+		wantErr bool
+	}{
+		{"wg-logger:", Labels{}, false},
+		{"wg-logger: owner=alice team=infra", Labels{"owner": "alice", "team": "infra"}, false},
+		{`wg-logger:  device="home laptop"	expires=2026-12-31 `, Labels{"device": "home laptop", "expires": "2026-12-31"}, false},
+		{"wg-logger: empty=", Labels{"empty": ""}, false},
+		{"wg-logger: owner", Labels{}, true},
+		{"wg-logger: =alice", Labels{}, true},
+		{"wg-logger: __name__=x", Labels{}, true},
+		{`wg-logger: device="home laptop`, Labels{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAnnotation(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAnnotation(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr {
+			assert.Equal(t, tt.want, got, tt.text)
+		}
+	}
+}
+
+func TestLabels_String(t *testing.T) {
+	assert.Equal(t, "{}", Labels{}.String())
+	assert.Equal(t, `{owner="alice",team="infra \"core\""}`, Labels{"team": `infra "core"`, "owner": "alice"}.String())
+}
@@ -0,0 +1,98 @@
+package wgconf
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// Problem is a violation of wg-logger conventions found by Lint.
+type Problem struct {
+	Line int
+	// Rule is the name of the convention
+	Rule    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d: [%s] %s", p.Line, p.Rule, p.Message)
+}
+
+// Lint checks the parsed config file for wg-logger conventions.
+// Problems are sorted by line number.
+func Lint(config *Config) (problems []Problem) {
+	add := func(line int, rule string, format string, a ...interface{}) {
+		problems = append(problems, Problem{Line: line, Rule: rule, Message: fmt.Sprintf(format, a...)})
+	}
+
+	for _, d := range config.Diagnostics {
+		add(d.Line, "syntax", "%s", d.Message)
+	}
+
+	type allowedIP struct {
+		line    int
+		network *net.IPNet
+	}
+	var allowedIPs []allowedIP
+	publicKeys := map[string]int{}
+
+	for _, peer := range config.Peers {
+		line := peer.PublicKeyLine
+		if line == 0 {
+			line = peer.Line
+		}
+
+		if peer.PublicKey != "" {
+			if first, ok := publicKeys[peer.PublicKey]; ok {
+				add(line, "duplicate-key", "public key '%s' is already used at line %d", peer.PublicKey, first)
+			} else {
+				publicKeys[peer.PublicKey] = line
+			}
+			if !isValidKey(peer.PublicKey) {
+				add(line, "invalid-key", "public key '%s' is not a base64 encoded 32 bytes key", peer.PublicKey)
+			}
+		}
+
+		if peer.FriendlyName == "" {
+			add(peer.Line, "no-name", "peer '%s' has no friendly name, add a comment at the line following [Peer]", peer.PublicKey)
+		}
+
+		for _, c := range peer.Comments {
+			switch {
+			case c.Annotation:
+				// annotations can be placed anywhere
+			case c.Inline:
+				add(c.Line, "misplaced-comment", "comment '%s' following a value is not used as friendly name", c.Text)
+			case c.Line != peer.Line+1:
+				add(c.Line, "misplaced-comment", "comment '%s' is not used as friendly name, it must be at the line following [Peer]", c.Text)
+			}
+		}
+
+		for _, ip := range peer.AllowedIPs {
+			_, network, err := net.ParseCIDR(ip)
+			if err != nil {
+				add(line, "invalid-allowed-ips", "AllowedIPs '%s' is not CIDR notation", ip)
+				continue
+			}
+			for _, other := range allowedIPs {
+				switch {
+				case other.network.String() == network.String():
+					add(line, "duplicate-allowed-ips", "AllowedIPs '%s' is already used at line %d", ip, other.line)
+				case other.network.Contains(network.IP) || network.Contains(other.network.IP):
+					add(line, "overlapping-allowed-ips", "AllowedIPs '%s' overlaps '%s' at line %d", ip, other.network, other.line)
+				}
+			}
+			allowedIPs = append(allowedIPs, allowedIP{line: line, network: network})
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return
+}
+
+// isValidKey reports whether the key is a base64 encoded Curve25519 key.
+func isValidKey(key string) bool {
+	b, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(b) == 32
+}
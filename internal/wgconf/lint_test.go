@@ -0,0 +1,64 @@
+package wgconf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lintStrings(problems []Problem) (got []string) {
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	return
+}
+
+func TestLint(t *testing.T) {
+	config, err := ParseFile("../../test/wg0.conf")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{
+		"line 14: [misplaced-comment] comment 'test' following a value is not used as friendly name",
+		"line 17: [no-name] peer 'bws0GsCPM0IT8OSgVirk6lgiRcOw6Ga3X62plId+PBU=' has no friendly name, add a comment at the line following [Peer]",
+		"line 20: [misplaced-comment] comment 'this is invalid format 01' is not used as friendly name, it must be at the line following [Peer]",
+		"line 23: [no-name] peer 'NyPEExViZP/KuPYkYPNAqd6jo3xrfy8yBGSKrEaKPyI=' has no friendly name, add a comment at the line following [Peer]",
+		"line 26: [misplaced-comment] comment 'this is invalid format 02' is not used as friendly name, it must be at the line following [Peer]",
+		"line 28: [no-name] peer 'ik8CbGUfpZ/sYK2uwOpyd8KO+o7rfy8yBGSKrEaKPyI=' has no friendly name, add a comment at the line following [Peer]",
+	}, lintStrings(Lint(config)))
+}
+
+func TestLint_Peers(t *testing.T) {
+	config, _ := Parse(strings.NewReader(`[Interface]
+ListenPort = 51820
+
+[Peer]
+# alice
+# wg-logger: owner=alice
+PublicKey = i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=
+AllowedIPs = 10.0.0.0/24
+
+[Peer]
+# bob
+PublicKey = i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=
+AllowedIPs = 10.0.0.2/32, 10.0.1.0/24
+
+[Peer]
+# carol
+PublicKey = not-a-key
+AllowedIPs = 10.0.1.0/24, 10.0.2.300/32
+`))
+	assert.Equal(t, []string{
+		"line 12: [duplicate-key] public key 'i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=' is already used at line 7",
+		"line 12: [overlapping-allowed-ips] AllowedIPs '10.0.0.2/32' overlaps '10.0.0.0/24' at line 7",
+		"line 17: [invalid-key] public key 'not-a-key' is not a base64 encoded 32 bytes key",
+		"line 17: [duplicate-allowed-ips] AllowedIPs '10.0.1.0/24' is already used at line 12",
+		"line 17: [invalid-allowed-ips] AllowedIPs '10.0.2.300/32' is not CIDR notation",
+	}, lintStrings(Lint(config)))
+
+	config, _ = Parse(strings.NewReader("[Peer]\n# alice\nPublicKey = i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=\nUnknown = 1\n"))
+	assert.Equal(t, []string{
+		"line 4: [syntax] unknown key 'Unknown' in [Peer] section",
+	}, lintStrings(Lint(config)))
+}
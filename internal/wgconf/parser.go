@@ -0,0 +1,305 @@
+package wgconf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config is the parsed wg-quick config file.
+type Config struct {
+	// Path to WireGuard config file
+	Path string
+	// Interface is the [Interface] section, nil if not described
+	Interface *Interface
+	// Peers are [Peer] sections in order of appearance
+	Peers []*Peer
+	// Diagnostics are problems found while parsing
+	Diagnostics []Diagnostic
+}
+
+// Interface is the [Interface] section.
+type Interface struct {
+	// Line is the line number of the section header
+	Line          int
+	Address       []string
+	ListenPort    int
+	HasPrivateKey bool
+	DNS           []string
+	MTU           int
+	Table         string
+	FwMark        string
+	SaveConfig    bool
+	PreUp         []string
+	PostUp        []string
+	PreDown       []string
+	PostDown      []string
+	Comments      []Comment
+}
+
+// Peer is a [Peer] section.
+type Peer struct {
+	// Line is the line number of the section header
+	Line int
+	// PublicKeyLine is the line number of PublicKey, 0 if not described
+	PublicKeyLine       int
+	PublicKey           string
+	HasPresharedKey     bool
+	AllowedIPs          []string
+	Endpoint            string
+	PersistentKeepalive int
+	// FriendlyName is the comment at the line following the section header
+	FriendlyName string
+	// Labels are key=value pairs in annotation comments
+	Labels   Labels
+	Comments []Comment
+}
+
+// Comment is a comment line, or a comment following a value.
+type Comment struct {
+	Line   int
+	Text   string
+	Inline bool
+	// Annotation is true when the comment is 'wg-logger: key=value ...'
+	Annotation bool
+}
+
+// Diagnostic is a problem found in the config file.
+type Diagnostic struct {
+	Line    int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d: %s", d.Line, d.Message)
+}
+
+// ParseFile parses the wg-quick config file.
+func ParseFile(confPath string) (*Config, error) {
+	f, err := os.Open(confPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config, err := Parse(f)
+	if config != nil {
+		config.Path = confPath
+	}
+	return config, err
+}
+
+// Parse parses the wg-quick config format.
+// Like wg-quick, section names and keys are case-insensitive and '#' starts a comment.
+func Parse(r io.Reader) (*Config, error) {
+	config := &Config{}
+	var section string
+	var iface *Interface
+	var peer *Peer
+	sectionLine := 0
+
+	diag := func(line int, format string, a ...interface{}) {
+		config.Diagnostics = append(config.Diagnostics, Diagnostic{
+			Line:    line,
+			Message: fmt.Sprintf(format, a...),
+		})
+	}
+
+	lineNumber := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		// comment line
+		if strings.HasPrefix(line, "#") {
+			c := Comment{Line: lineNumber, Text: strings.TrimSpace(strings.TrimLeft(line, "#"))}
+			c.Annotation = isAnnotation(c.Text)
+			switch section {
+			case "interface":
+				iface.Comments = append(iface.Comments, c)
+				if c.Annotation {
+					diag(lineNumber, "annotation is only available in [Peer] section")
+				}
+			case "peer":
+				peer.Comments = append(peer.Comments, c)
+				if c.Annotation {
+					parsePeerAnnotation(peer, c, diag)
+				} else if lineNumber == sectionLine+1 {
+					// the comment at 1st line is treated as friendly name
+					peer.FriendlyName = c.Text
+				}
+			}
+			continue
+		}
+
+		var inline *Comment
+		if i := strings.Index(line, "#"); i >= 0 {
+			inline = &Comment{Line: lineNumber, Text: strings.TrimSpace(strings.TrimLeft(line[i:], "#")), Inline: true}
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+
+		// section header
+		if strings.HasPrefix(line, "[") {
+			sectionLine = lineNumber
+			switch strings.ToLower(line) {
+			case "[interface]":
+				if config.Interface != nil {
+					diag(lineNumber, "duplicate [Interface] section (first at line %d)", config.Interface.Line)
+				}
+				section = "interface"
+				iface = &Interface{Line: lineNumber}
+				config.Interface = iface
+			case "[peer]":
+				section = "peer"
+				peer = &Peer{Line: lineNumber}
+				config.Peers = append(config.Peers, peer)
+			default:
+				section = "unknown"
+				diag(lineNumber, "unknown section '%s'", line)
+			}
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			diag(lineNumber, "invalid line '%s', want 'Key = Value'", line)
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		value := strings.TrimSpace(kv[1])
+
+		switch section {
+		case "interface":
+			parseInterfaceKey(iface, key, value, lineNumber, diag)
+			if inline != nil {
+				iface.Comments = append(iface.Comments, *inline)
+			}
+		case "peer":
+			parsePeerKey(peer, key, value, lineNumber, diag)
+			if inline != nil {
+				peer.Comments = append(peer.Comments, *inline)
+			}
+		case "":
+			diag(lineNumber, "'%s' is outside of any section", key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, p := range config.Peers {
+		if p.PublicKey == "" {
+			diag(p.Line, "[Peer] section has no PublicKey")
+		}
+	}
+
+	return config, nil
+}
+
+func parsePeerAnnotation(peer *Peer, c Comment, diag func(int, string, ...interface{})) {
+	labels, err := parseAnnotation(c.Text)
+	if err != nil {
+		diag(c.Line, "invalid annotation: %v", err)
+	}
+	if peer.Labels == nil {
+		peer.Labels = Labels{}
+	}
+	for k, v := range labels {
+		if _, ok := peer.Labels[k]; ok {
+			diag(c.Line, "duplicate label '%s'", k)
+		}
+		peer.Labels[k] = v
+	}
+}
+
+func splitList(value string) (list []string) {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return
+}
+
+func parseInt(value string, min int, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("must be an integer between %d and %d", min, max)
+	}
+	return n, nil
+}
+
+func parseInterfaceKey(iface *Interface, key string, value string, line int, diag func(int, string, ...interface{})) {
+	var err error
+	switch strings.ToLower(key) {
+	case "address":
+		iface.Address = append(iface.Address, splitList(value)...)
+	case "listenport":
+		iface.ListenPort, err = parseInt(value, 0, 65535)
+	case "privatekey":
+		iface.HasPrivateKey = value != ""
+	case "dns":
+		iface.DNS = append(iface.DNS, splitList(value)...)
+	case "mtu":
+		iface.MTU, err = parseInt(value, 0, 65535)
+	case "table":
+		iface.Table = value
+	case "fwmark":
+		iface.FwMark = value
+	case "saveconfig":
+		iface.SaveConfig, err = strconv.ParseBool(value)
+	case "preup":
+		iface.PreUp = append(iface.PreUp, value)
+	case "postup":
+		iface.PostUp = append(iface.PostUp, value)
+	case "predown":
+		iface.PreDown = append(iface.PreDown, value)
+	case "postdown":
+		iface.PostDown = append(iface.PostDown, value)
+	default:
+		diag(line, "unknown key '%s' in [Interface] section", key)
+	}
+	if err != nil {
+		diag(line, "invalid value '%s' for %s: %v", value, key, err)
+	}
+}
+
+func parsePeerKey(peer *Peer, key string, value string, line int, diag func(int, string, ...interface{})) {
+	var err error
+	switch strings.ToLower(key) {
+	case "publickey":
+		if peer.PublicKeyLine > 0 {
+			diag(line, "duplicate PublicKey in [Peer] section (first at line %d)", peer.PublicKeyLine)
+		}
+		peer.PublicKey = value
+		peer.PublicKeyLine = line
+	case "presharedkey":
+		peer.HasPresharedKey = value != ""
+	case "allowedips":
+		peer.AllowedIPs = append(peer.AllowedIPs, splitList(value)...)
+	case "endpoint":
+		peer.Endpoint = value
+		if _, _, err = net.SplitHostPort(value); err != nil {
+			err = fmt.Errorf("must be 'host:port'")
+		}
+	case "persistentkeepalive":
+		if strings.ToLower(value) == "off" {
+			peer.PersistentKeepalive = 0
+		} else {
+			peer.PersistentKeepalive, err = parseInt(value, 0, 65535)
+		}
+	default:
+		diag(line, "unknown key '%s' in [Peer] section", key)
+	}
+	if err != nil {
+		diag(line, "invalid value '%s' for %s: %v", value, key, err)
+	}
+}
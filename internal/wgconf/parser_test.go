@@ -0,0 +1,136 @@
+package wgconf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFile(t *testing.T) {
+	config, err := ParseFile("../../test/wg0.conf")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	iface := config.Interface
+	if assert.NotNil(t, iface) {
+		assert.Equal(t, 1, iface.Line)
+		assert.Equal(t, []string{"192.168.100.100/24"}, iface.Address)
+		assert.Equal(t, 50000, iface.ListenPort)
+		assert.True(t, iface.HasPrivateKey)
+		assert.False(t, iface.SaveConfig)
+	}
+
+	if !assert.Len(t, config.Peers, 5) {
+		return
+	}
+	peer := config.Peers[1]
+	assert.Equal(t, 12, peer.Line)
+	assert.Equal(t, 14, peer.PublicKeyLine)
+	assert.Equal(t, "63clN7mNlJ7ckYH7VirX1VyAfXwR4t9DP9DRp2qMu0o=", peer.PublicKey)
+	assert.Equal(t, []string{"192.168.100.2/32"}, peer.AllowedIPs)
+	assert.Equal(t, "2nd person (comment in PublicKey)", peer.FriendlyName)
+	assert.Equal(t, []Comment{
+		{Line: 13, Text: "2nd person (comment in PublicKey)"},
+		{Line: 14, Text: "test", Inline: true},
+	}, peer.Comments)
+
+	assert.Equal(t, "", config.Peers[2].FriendlyName)
+	assert.Equal(t, []Comment{
+		{Line: 18, Text: ""},
+		{Line: 20, Text: "this is invalid format 01"},
+	}, config.Peers[2].Comments)
+	assert.Equal(t, "", config.Peers[3].FriendlyName)
+	assert.Empty(t, config.Diagnostics)
+}
+
+func TestParse(t *testing.T) {
+	input := `
+[Interface]
+Address = 10.0.0.1/24, fd00::1/64
+ListenPort = 51820
+DNS = 10.0.0.53,10.0.0.54
+PostUp = iptables -A FORWARD -i %i -j ACCEPT
+PostUp = iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE
+PreDown = echo down
+mtu = 1420
+
+[peer]
+# laptop
+# wg-logger: owner=alice team=infra
+# wg-logger: device="alice's laptop" expires=2026-12-31
+publickey = i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=
+PresharedKey = abcdefghijklmn/opqrstuvwxyzABC123DEF456GHI7=
+AllowedIPs = 10.0.0.2/32
+AllowedIPs = fd00::2/128
+Endpoint = 203.0.113.1:51820
+PersistentKeepalive = 25
+`
+	config, err := Parse(strings.NewReader(input))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"10.0.0.1/24", "fd00::1/64"}, config.Interface.Address)
+	assert.Equal(t, 51820, config.Interface.ListenPort)
+	assert.Equal(t, []string{"10.0.0.53", "10.0.0.54"}, config.Interface.DNS)
+	assert.Len(t, config.Interface.PostUp, 2)
+	assert.Equal(t, []string{"echo down"}, config.Interface.PreDown)
+	assert.Equal(t, 1420, config.Interface.MTU)
+
+	if assert.Len(t, config.Peers, 1) {
+		peer := config.Peers[0]
+		assert.Equal(t, "laptop", peer.FriendlyName)
+		assert.True(t, peer.HasPresharedKey)
+		assert.Equal(t, []string{"10.0.0.2/32", "fd00::2/128"}, peer.AllowedIPs)
+		assert.Equal(t, "203.0.113.1:51820", peer.Endpoint)
+		assert.Equal(t, 25, peer.PersistentKeepalive)
+		assert.Equal(t, Labels{
+			"owner":   "alice",
+			"team":    "infra",
+			"device":  "alice's laptop",
+			"expires": "2026-12-31",
+		}, peer.Labels)
+	}
+	assert.Empty(t, config.Diagnostics)
+}
+
+func TestParse_Diagnostics(t *testing.T) {
+	input := `Address = 10.0.0.1/24
+[Interface]
+ListenPort = port
+Unknown = 1
+[Interface]
+[Peer]
+Endpoint = 203.0.113.1
+PersistentKeepalive = off
+[Peer]
+# wg-logger: owner
+# wg-logger: 1team=infra
+PublicKey = a
+PublicKey = b
+broken line
+[Foo]
+`
+	config, err := Parse(strings.NewReader(input))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var got []string
+	for _, d := range config.Diagnostics {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		"line 1: 'Address' is outside of any section",
+		"line 3: invalid value 'port' for ListenPort: must be an integer between 0 and 65535",
+		"line 4: unknown key 'Unknown' in [Interface] section",
+		"line 5: duplicate [Interface] section (first at line 2)",
+		"line 7: invalid value '203.0.113.1' for Endpoint: must be 'host:port'",
+		"line 10: invalid annotation: invalid label 'owner', want 'key=value'",
+		"line 11: invalid annotation: invalid label name '1team'",
+		"line 13: duplicate PublicKey in [Peer] section (first at line 12)",
+		"line 14: invalid line 'broken line', want 'Key = Value'",
+		"line 15: unknown section '[Foo]'",
+		"line 6: [Peer] section has no PublicKey",
+	}, got)
+}
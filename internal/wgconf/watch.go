@@ -0,0 +1,146 @@
+package wgconf
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+)
+
+// Change is the difference of peers between before and after the config file is modified.
+type Change struct {
+	// Added and Removed are public keys
+	Added   []string
+	Removed []string
+	Renamed []Rename
+	// Diagnostics are problems found in the modified config file,
+	// only when they differ from the problems found in the previous one
+	Diagnostics []Diagnostic
+}
+
+// Rename is the change of a peer's friendly name.
+type Rename struct {
+	PublicKey string
+	From      string
+	To        string
+}
+
+func (r Rename) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("public_key", r.PublicKey).
+		Str("from", r.From).
+		Str("to", r.To)
+}
+
+// Empty reports whether peers are not changed. Diagnostics are not counted.
+func (c Change) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Renamed) == 0
+}
+
+// Diff returns added, removed and renamed peers from before to after.
+func Diff(before *Config, after *Config) (change Change) {
+	peersOf := func(c *Config) map[string]*Peer {
+		peers := make(map[string]*Peer)
+		for _, p := range c.Peers {
+			if p.PublicKey != "" {
+				peers[p.PublicKey] = p
+			}
+		}
+		return peers
+	}
+	b, a := peersOf(before), peersOf(after)
+
+	for key, p := range a {
+		bp, ok := b[key]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, key)
+		case bp.FriendlyName != p.FriendlyName:
+			change.Renamed = append(change.Renamed, Rename{PublicKey: key, From: bp.FriendlyName, To: p.FriendlyName})
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			change.Removed = append(change.Removed, key)
+		}
+	}
+	sort.Strings(change.Added)
+	sort.Strings(change.Removed)
+	sort.Slice(change.Renamed, func(i, j int) bool { return change.Renamed[i].PublicKey < change.Renamed[j].PublicKey })
+	if !sameDiagnostics(before.Diagnostics, after.Diagnostics) {
+		change.Diagnostics = after.Diagnostics
+	}
+	return
+}
+
+func sameDiagnostics(a []Diagnostic, b []Diagnostic) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Watch watches the config file with inotify and reloads it when it is written or replaced.
+// The directory is watched, because editors and config management tools replace the file by rename.
+// Without Watch, or after Watch fails, the config file is checked every Load by polling.
+// onError is called when the watcher stops with errors.
+func (c *WGConf) Watch(onError func(error)) (stop func(), err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err = watcher.Add(filepath.Dir(c.Path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.watching = true
+	c.mu.Unlock()
+
+	name := filepath.Clean(c.Path)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != name || event.Op == fsnotify.Chmod {
+					continue
+				}
+				c.mu.Lock()
+				c.invalidated = true
+				// reload now to notify changes, errors will be reported by the next Load
+				_, _, _ = c.load()
+				c.mu.Unlock()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				// fall back to polling
+				c.mu.Lock()
+				c.watching = false
+				c.mu.Unlock()
+				if onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		watcher.Close()
+		<-done
+		c.mu.Lock()
+		c.watching = false
+		c.mu.Unlock()
+	}, nil
+}
@@ -0,0 +1,144 @@
+package wgconf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const watchTestConf = `[Peer]
+# alice
+PublicKey = key1
+[Peer]
+# bob
+PublicKey = key2
+`
+
+func TestDiff(t *testing.T) {
+	before, _ := Parse(strings.NewReader(watchTestConf))
+	after, _ := Parse(strings.NewReader(`[Peer]
+# alice's laptop
+PublicKey = key1
+[Peer]
+# carol
+PublicKey = key3
+[Peer]
+Foo = bar
+`))
+	change := Diff(before, after)
+	assert.Equal(t, []string{"key3"}, change.Added)
+	assert.Equal(t, []string{"key2"}, change.Removed)
+	assert.Equal(t, []Rename{{PublicKey: "key1", From: "alice", To: "alice's laptop"}}, change.Renamed)
+	assert.Len(t, change.Diagnostics, 2)
+
+	assert.True(t, Diff(before, before).Empty())
+
+	// the same diagnostics are not reported again, and do not make a change
+	change = Diff(after, after)
+	assert.True(t, change.Empty())
+	assert.Empty(t, change.Diagnostics)
+	change = Diff(after, before)
+	assert.False(t, change.Empty())
+	assert.Empty(t, change.Diagnostics)
+}
+
+func writeTestConf(t *testing.T, dir string, content string) string {
+	path := filepath.Join(dir, "wg0.conf")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWGConf_Polling(t *testing.T) {
+	path := writeTestConf(t, t.TempDir(), watchTestConf)
+	c, err := New(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var changes []Change
+	c.OnChange = func(change Change) {
+		changes = append(changes, change)
+	}
+	names, err := c.GetFriendlyNameMap()
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", names["key2"])
+
+	// edit in the same second with the same size
+	stat, _ := os.Stat(path)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(strings.Replace(watchTestConf, "bob", "dan", 1)), 0600))
+	assert.NoError(t, os.Chtimes(path, stat.ModTime(), stat.ModTime()))
+
+	names, err = c.GetFriendlyNameMap()
+	assert.NoError(t, err)
+	assert.Equal(t, "dan", names["key2"])
+	assert.Equal(t, []Change{{Renamed: []Rename{{PublicKey: "key2", From: "bob", To: "dan"}}}}, changes)
+
+	// new diagnostics are notified without peer changes, and not notified again
+	broken := strings.Replace(watchTestConf, "bob", "dan", 1) + "[Peer]\nFoo = bar\n"
+	for _, content := range []string{broken, broken + "\n", "# comment\n" + strings.Replace(watchTestConf, "bob", "dan", 1)} {
+		changes = nil
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		_, reloaded, err := c.Load()
+		assert.NoError(t, err)
+		assert.True(t, reloaded)
+		if content == broken {
+			if assert.Len(t, changes, 1) {
+				assert.True(t, changes[0].Empty())
+				assert.NotEmpty(t, changes[0].Diagnostics)
+			}
+		} else {
+			assert.Empty(t, changes)
+		}
+	}
+}
+
+func TestWGConf_Watch(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConf(t, dir, watchTestConf)
+	c, err := New(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	changes := make(chan Change, 10)
+	c.OnChange = func(change Change) {
+		changes <- change
+	}
+	_, _, err = c.Load()
+	assert.NoError(t, err)
+
+	stop, err := c.Watch(nil)
+	if err != nil {
+		t.Skipf("inotify is not available: %v", err)
+	}
+	defer stop()
+
+	// replace the file by rename, like editors and config management tools
+	tmp := filepath.Join(dir, ".wg0.conf.tmp")
+	assert.NoError(t, ioutil.WriteFile(tmp, []byte(watchTestConf+"[Peer]\n# carol\nPublicKey = key3\n"), 0600))
+	assert.NoError(t, os.Rename(tmp, path))
+
+	select {
+	case change := <-changes:
+		assert.Equal(t, []string{"key3"}, change.Added)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change was not notified")
+	}
+
+	names, err := c.GetFriendlyNameMap()
+	assert.NoError(t, err)
+	assert.Equal(t, "carol", names["key3"])
+
+	// other files in the directory are ignored
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "wg1.conf"), []byte(""), 0600))
+	select {
+	case change := <-changes:
+		t.Errorf("unexpected change: %v", change)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -1,18 +1,33 @@
 package wgconf
 
 import (
-	"bufio"
+	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"strings"
+	"sync"
 	"time"
 )
 
+// NoName is the friendly name of peers without name comment
+const NoName = "(no name)"
+
 type WGConf struct {
 	// Path to WireGuard config file
 	Path string
 	// Modtime is modified time of config file
-	ModTime         time.Time
+	ModTime time.Time
+	// Size and Hash are the size and SHA-256 of loaded config file
+	Size int64
+	Hash [sha256.Size]byte
+	// OnChange is called when the config file is reloaded with changes of peers or diagnostics
+	OnChange func(Change)
+
+	mu              sync.Mutex
+	watching        bool
+	invalidated     bool
+	config          *Config
 	friendryNameMap map[string]string
 }
 
@@ -28,75 +43,107 @@ func New(confPath string) (wgconf *WGConf, err error) {
 	}, nil
 }
 
-// GetFriendlyNameMap returns a map with peer's public key as key, peer's friendly name as value.
-func (c *WGConf) GetFriendlyNameMap() (names map[string]string, err error) {
+// Load returns the parsed config file. The parsed result is cached until the file is modified.
+func (c *WGConf) Load() (config *Config, reloaded bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.load()
+}
+
+func (c *WGConf) load() (config *Config, reloaded bool, err error) {
+	if c.watching && !c.invalidated && c.config != nil {
+		// watcher tells the file is not modified
+		return c.config, false, nil
+	}
+
 	stat, err := os.Stat(c.Path)
 	if os.IsNotExist(err) {
-		return names, fmt.Errorf("%s is not found", c.Path)
+		return nil, false, fmt.Errorf("%s is not found", c.Path)
+	}
+	if err != nil {
+		return nil, false, err
 	}
 
-	if stat.ModTime() == c.ModTime && len(c.friendryNameMap) > 0 {
+	// mtime is not enough to detect edits in the same second,
+	// so compare size and hash of the content as well
+	data, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return nil, false, err
+	}
+	hash := sha256.Sum256(data)
+	if c.config != nil && stat.ModTime() == c.ModTime && int64(len(data)) == c.Size && hash == c.Hash {
 		// return cache
-		return c.friendryNameMap, nil
+		c.invalidated = false
+		return c.config, false, nil
 	}
 
-	names = make(map[string]string)
-	file, err := os.Open(c.Path)
+	config, err = Parse(bytes.NewReader(data))
 	if err != nil {
-		return
+		return nil, false, err
 	}
-	defer file.Close()
-
-	publicKey := ""
-	friendlyName := ""
-	lineNumber := 0
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		lineNumber++
-
-		switch {
-		case strings.HasPrefix(line, "[Peer]"):
-			fallthrough
-		case strings.HasPrefix(line, "[peer]"):
-			if publicKey != "" {
-				if friendlyName != "" {
-					names[publicKey] = friendlyName
-				} else {
-					names[publicKey] = "(no name)"
-				}
-			}
-			publicKey = ""
-			friendlyName = ""
-			lineNumber = 0
-			continue
-		case strings.HasPrefix(strings.ToLower(strings.TrimLeft(line, " \t")), "publickey"):
-			// parse public key
-			kv := strings.SplitN(line, "=", 2)
-			v := strings.SplitN(kv[1], "#", 2)
-			publicKey = strings.TrimSpace(v[0])
-			continue
-		case lineNumber == 1:
-			// the comment at 1st line is treated as friendly name
-			if strings.HasPrefix(line, "#") {
-				friendlyName = strings.TrimLeft(line, "# ")
-			}
-			continue
+	config.Path = c.Path
+
+	previous := c.config
+	c.ModTime = stat.ModTime()
+	c.Size = int64(len(data))
+	c.Hash = hash
+	c.invalidated = false
+	c.config = config
+	c.friendryNameMap = nil
+
+	if previous != nil && c.OnChange != nil {
+		if change := Diff(previous, config); !change.Empty() || len(change.Diagnostics) > 0 {
+			c.OnChange(change)
 		}
 	}
+	return config, true, nil
+}
 
-	if publicKey != "" {
-		if friendlyName != "" {
-			names[publicKey] = friendlyName
+// GetFriendlyNameMap returns a map with peer's public key as key, peer's friendly name as value.
+func (c *WGConf) GetFriendlyNameMap() (names map[string]string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	config, reloaded, err := c.load()
+	if err != nil {
+		return
+	}
+	if !reloaded && len(c.friendryNameMap) > 0 {
+		// return cache
+		return c.friendryNameMap, nil
+	}
+
+	names = make(map[string]string)
+	for _, peer := range config.Peers {
+		if peer.PublicKey == "" {
+			continue
+		}
+		if peer.FriendlyName != "" {
+			names[peer.PublicKey] = peer.FriendlyName
 		} else {
-			names[publicKey] = "no name"
+			names[peer.PublicKey] = NoName
 		}
 	}
 
-	if err = scanner.Err(); err != nil {
+	c.friendryNameMap = names
+	return
+}
+
+// GetLabelsMap returns a map with peer's public key as key, peer's labels as value.
+func (c *WGConf) GetLabelsMap() (labels map[string]Labels, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	config, _, err := c.load()
+	if err != nil {
 		return
 	}
 
-	c.friendryNameMap = names
+	labels = make(map[string]Labels)
+	for _, peer := range config.Peers {
+		if peer.PublicKey != "" && len(peer.Labels) > 0 {
+			labels[peer.PublicKey] = peer.Labels
+		}
+	}
 	return
 }
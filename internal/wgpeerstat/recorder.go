@@ -0,0 +1,142 @@
+package wgpeerstat
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dumpFilePrefix = "wg-dump-"
+	dumpFileExt    = ".txt.gz"
+	// redacted replaces private keys and preshared keys, like 'wg show' does
+	redacted = "(hidden)"
+)
+
+// Recorder writes outputs of 'wg show all dump' into a directory as snapshots,
+// which are read by ReadSnapshots, e.g. wg-dump-20200924T080028Z.txt.gz
+type Recorder struct {
+	Dir string
+	// Every records a snapshot every N calls of Record
+	Every int64
+	// MaxAge is the age of snapshots to remove, 0 keeps all
+	MaxAge time.Duration
+
+	mu    sync.Mutex
+	count int64
+}
+
+// NewRecorder returns a recorder which keeps snapshots for maxDays days.
+func NewRecorder(dir string, every int64, maxDays int64) *Recorder {
+	if every <= 0 {
+		every = 1
+	}
+	return &Recorder{
+		Dir:    dir,
+		Every:  every,
+		MaxAge: time.Duration(maxDays) * 24 * time.Hour,
+	}
+}
+
+// Record writes the lines as the snapshot at t, at the first call and every Every calls after it.
+// Snapshots older than MaxAge are removed at the same time.
+func (r *Recorder) Record(t time.Time, lines []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.count
+	r.count++
+	if n%r.Every != 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(r.Dir, 0700); err != nil {
+		return err
+	}
+	if err := r.write(t, redactDump(lines)); err != nil {
+		return err
+	}
+	if r.MaxAge > 0 {
+		return r.prune(t.Add(-r.MaxAge))
+	}
+	return nil
+}
+
+// write creates the snapshot with a temporary name and renames it,
+// so a half written snapshot is never read by replay.
+func (r *Recorder) write(t time.Time, lines []string) (err error) {
+	f, err := os.CreateTemp(r.Dir, "."+dumpFilePrefix+"*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	if _, err = gz.Write([]byte(strings.Join(lines, "\n"))); err != nil {
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	name := dumpFilePrefix + t.UTC().Format(SnapshotTimeFormat) + dumpFileExt
+	return os.Rename(f.Name(), filepath.Join(r.Dir, name))
+}
+
+// prune removes snapshots recorded before t, other files in the directory are kept.
+func (r *Recorder) prune(t time.Time) error {
+	entries, err := os.ReadDir(r.Dir)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, dumpFilePrefix) || !strings.HasSuffix(name, dumpFileExt) {
+			continue
+		}
+		recorded, err := time.Parse(SnapshotTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, dumpFilePrefix), dumpFileExt))
+		if err != nil || !recorded.Before(t) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.Dir, name)); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot remove old snapshots: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// redactDump replaces private keys of interfaces and preshared keys of peers.
+// Lines which are not peers are treated as interfaces, so a malformed line never leaks the key.
+//
+//	interface: name, private-key, public-key, listen-port, fwmark
+//	peer:      name, public-key, preshared-key, endpoint, allowed-ips, latest-handshake, transfer-rx, transfer-tx, persistent-keepalive
+func redactDump(lines []string) []string {
+	redactedLines := make([]string, len(lines))
+	for n, line := range lines {
+		values := strings.Split(line, "\t")
+		switch {
+		case len(values) == 9:
+			if values[2] != "(none)" {
+				values[2] = redacted
+			}
+		case len(values) >= 2:
+			values[1] = redacted
+		}
+		redactedLines[n] = strings.Join(values, "\t")
+	}
+	return redactedLines
+}
@@ -0,0 +1,69 @@
+package wgpeerstat
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var recorderDump = []string{
+	"wg0\tWEPPSZ8gcWmd8W7YPE/dGm3lwPe2xLONBqX5ANjpKl0=\tVv3TfSu93ooR0E/KQCcxIDTMdBzTyEBnUwbIGK4B3fS=\t48571\toff",
+	"wg0\ti+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=\t(none)\t123.45.67.89:64680\t192.168.100.1/32\t1599229650\t5158442100\t4018503000\toff",
+	"wg0\t63clN7mNlJ7ckYH7VirX1VyAfXwR4t9DP9DRp2qMu0o=\tc2VjcmV0LXByZXNoYXJlZC1rZXktZm9yLXRlc3Qtb25seQ==\t239.14.56.78:64515\t192.168.100.2/32\t1599229359\t7479995699\t6524875788\t25",
+	"",
+}
+
+func recordedFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRecorder_Record(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dump")
+	r := NewRecorder(dir, 2, 1)
+	start := time.Date(2020, 9, 4, 14, 30, 0, 0, time.FixedZone("JST", 9*60*60))
+	for i := 0; i < 5; i++ {
+		if err := r.Record(start.Add(time.Duration(i)*time.Minute), recorderDump); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, []string{
+		"wg-dump-20200904T053000Z.txt.gz",
+		"wg-dump-20200904T053200Z.txt.gz",
+		"wg-dump-20200904T053400Z.txt.gz",
+	}, recordedFiles(t, dir))
+
+	snapshots, err := ReadSnapshots(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, snapshots, 3)
+	assert.True(t, start.Equal(snapshots[0].Time))
+	assert.Equal(t, []string{
+		"wg0\t(hidden)\tVv3TfSu93ooR0E/KQCcxIDTMdBzTyEBnUwbIGK4B3fS=\t48571\toff",
+		"wg0\ti+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=\t(none)\t123.45.67.89:64680\t192.168.100.1/32\t1599229650\t5158442100\t4018503000\toff",
+		"wg0\t63clN7mNlJ7ckYH7VirX1VyAfXwR4t9DP9DRp2qMu0o=\t(hidden)\t239.14.56.78:64515\t192.168.100.2/32\t1599229359\t7479995699\t6524875788\t25",
+	}, snapshots[0].Lines)
+	assert.Equal(t, ParseDump(recorderDump), snapshots[2].PeerStats())
+}
+
+func TestRedactDump(t *testing.T) {
+	lines := redactDump([]string{
+		// separated with spaces by mistake
+		"wg0\tWEPPSZ8gcWmd8W7YPE/dGm3lwPe2xLONBqX5ANjpKl0=  Vv3TfSu93ooR0E/KQCcxIDTMdBzTyEBnUwbIGK4B3fS=\t48571\toff",
+		"",
+	})
+	assert.Equal(t, []string{"wg0\t(hidden)\t48571\toff", ""}, lines)
+}
@@ -0,0 +1,143 @@
+package wgpeerstat
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotTimeFormat is the timestamp in names of snapshot files, in UTC,
+// e.g. wg-dump-20200924T080028Z.txt
+const SnapshotTimeFormat = "20060102T150405Z"
+
+var snapshotTimePattern = regexp.MustCompile(`\d{8}T\d{6}Z`)
+
+// Snapshot is the output of 'wg show all dump' at Time.
+type Snapshot struct {
+	Time  time.Time
+	Lines []string
+}
+
+// PeerStats returns the status of peers in the snapshot.
+func (s Snapshot) PeerStats() []PeerStat {
+	return ParseDump(s.Lines)
+}
+
+// ReadSnapshots reads snapshots in time order from a directory or a file.
+//
+// Each file in the directory is a snapshot, and its time is in the name
+// (see SnapshotTimeFormat). Files compressed with gzip end with '.gz'.
+//
+// A file has snapshots which start with '# <RFC3339 time>' lines.
+// A file without them is a snapshot at the modified time of the file.
+func ReadSnapshots(path string) ([]Snapshot, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return readSnapshotFile(path, fi.ModTime())
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []Snapshot
+	for _, e := range entries {
+		stamp := snapshotTimePattern.FindString(e.Name())
+		if e.IsDir() || stamp == "" {
+			continue
+		}
+		t, err := time.Parse(SnapshotTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		lines, err := readSnapshotLines(filepath.Join(path, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, Snapshot{Time: t, Lines: lines})
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+func readSnapshotLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return lines, nil
+}
+
+func readSnapshotFile(path string, modTime time.Time) ([]Snapshot, error) {
+	lines, err := readSnapshotLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			headers = true
+			break
+		}
+	}
+	if !headers {
+		return []Snapshot{{Time: modTime, Lines: lines}}, nil
+	}
+
+	var snapshots []Snapshot
+	for n, line := range lines {
+		if !strings.HasPrefix(line, "#") {
+			if len(snapshots) == 0 {
+				if strings.TrimSpace(line) != "" {
+					return nil, fmt.Errorf("%s:%d: '# <time>' line is expected before the snapshot", path, n+1)
+				}
+				continue
+			}
+			last := &snapshots[len(snapshots)-1]
+			last.Lines = append(last.Lines, line)
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(strings.TrimPrefix(line, "#")))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid time of snapshot: %w", path, n+1, err)
+		}
+		if len(snapshots) > 0 && !t.After(snapshots[len(snapshots)-1].Time) {
+			return nil, fmt.Errorf("%s:%d: time of snapshot must be after the previous one", path, n+1)
+		}
+		snapshots = append(snapshots, Snapshot{Time: t})
+	}
+	return snapshots, nil
+}
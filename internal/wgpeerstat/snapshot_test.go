@@ -0,0 +1,90 @@
+package wgpeerstat
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSnapshots_File(t *testing.T) {
+	snapshots, err := ReadSnapshots("../../test/replay/snapshots.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, snapshots, 3)
+	assert.Equal(t, time.Date(2020, 9, 4, 14, 30, 0, 0, time.UTC), snapshots[0].Time.UTC())
+	assert.Equal(t, time.Date(2020, 9, 4, 15, 20, 0, 0, time.UTC), snapshots[2].Time.UTC())
+
+	stats := snapshots[2].PeerStats()
+	assert.Len(t, stats, 2)
+	assert.Equal(t, "10.1.1.1:64681", stats[0].Endpoint)
+	assert.Equal(t, time.Unix(1599232800, 0), stats[0].LatestHandshake)
+}
+
+func TestReadSnapshots_FileWithoutTime(t *testing.T) {
+	snapshots, err := ReadSnapshots("../../test/wg-show-all-dump.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat("../../test/wg-show-all-dump.txt")
+	assert.Len(t, snapshots, 1)
+	assert.Equal(t, fi.ModTime(), snapshots[0].Time)
+	assert.Len(t, snapshots[0].PeerStats(), 4)
+}
+
+func TestReadSnapshots_Directory(t *testing.T) {
+	dir := t.TempDir()
+	dump := "wg0\tprivate\tpublic\t48571\toff\n" +
+		"wg0\ti+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=\t(none)\t123.45.67.89:64680\t192.168.100.1/32\t1599229650\t5158442100\t4018503000\toff\n"
+	if err := os.WriteFile(filepath.Join(dir, "wg-dump-20200904T143100Z.txt"), []byte(dump), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "wg-dump-20200904T143000Z.txt.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	_, _ = gz.Write([]byte(dump))
+	gz.Close()
+	f.Close()
+	// files without time are skipped
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("note"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := ReadSnapshots(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, snapshots, 2)
+	assert.Equal(t, time.Date(2020, 9, 4, 14, 30, 0, 0, time.UTC), snapshots[0].Time)
+	assert.Equal(t, time.Date(2020, 9, 4, 14, 31, 0, 0, time.UTC), snapshots[1].Time)
+	assert.Len(t, snapshots[0].PeerStats(), 1)
+	assert.Len(t, snapshots[1].PeerStats(), 1)
+}
+
+func TestReadSnapshots_Invalid(t *testing.T) {
+	invalidTests := []struct {
+		Name    string
+		Content string
+		Want    string
+	}{
+		{"time", "# yesterday\n", "2: invalid time of snapshot"},
+		{"order", "# 2020-09-04T14:31:00Z\n# 2020-09-04T14:30:00Z\n", "3: time of snapshot must be after the previous one"},
+		{"no time", "wg0\tprivate\tpublic\t48571\toff\n# 2020-09-04T14:30:00Z\n", "2: '# <time>' line is expected before the snapshot"},
+	}
+	for _, tt := range invalidTests {
+		path := filepath.Join(t.TempDir(), "snapshots.txt")
+		if err := os.WriteFile(path, []byte("\n"+tt.Content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadSnapshots(path)
+		if assert.Error(t, err, tt.Name) {
+			assert.Contains(t, err.Error(), path+":"+tt.Want, tt.Name)
+		}
+	}
+}
@@ -76,12 +76,22 @@ func _readWGDump(wgCommand string) (lines []string, err error) {
 	return strings.Split(out.String(), "\n"), nil
 }
 
+// ReadDump returns lines of 'wg show all dump'.
+func ReadDump(wgCommand string) ([]string, error) {
+	return readWGDump(wgCommand)
+}
+
 func GetPeerStats(wgCommand string) ([]PeerStat, error) {
-	var peerStats []PeerStat
-	lines, err := readWGDump(wgCommand)
+	lines, err := ReadDump(wgCommand)
 	if err != nil {
-		return peerStats, err
+		return nil, err
 	}
+	return ParseDump(lines), nil
+}
+
+// ParseDump parses lines of 'wg show all dump', lines which are not peers are skipped.
+func ParseDump(lines []string) []PeerStat {
+	var peerStats []PeerStat
 
 	// wg-tools returns these lines:
 	//   1: private-key,  public-key, listen-port, fwmark.
@@ -101,5 +111,5 @@ func GetPeerStats(wgCommand string) ([]PeerStat, error) {
 		peerStats = append(peerStats, peerStat)
 	}
 
-	return peerStats, nil
+	return peerStats
 }
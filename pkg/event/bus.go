@@ -0,0 +1,77 @@
+package event
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Bus publishes events to subscribed handlers. The zero value is ready to use,
+// and it is safe for concurrent use.
+type Bus struct {
+	mu            sync.RWMutex
+	subscriptions []*subscription
+}
+
+type subscription struct {
+	handler Handler
+	// types are types to receive, empty means all types
+	types map[Type]bool
+}
+
+// Subscribe adds the handler for events of types, or all events when types are omitted.
+// Handlers are called in the order of Subscribe. The returned function removes the handler.
+func (b *Bus) Subscribe(h Handler, types ...Type) (unsubscribe func()) {
+	s := &subscription{handler: h}
+	if len(types) > 0 {
+		s.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.subscriptions = append(b.subscriptions, s)
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			for i, sub := range b.subscriptions {
+				if sub == s {
+					b.subscriptions = append(b.subscriptions[:i:i], b.subscriptions[i+1:]...)
+					return
+				}
+			}
+		})
+	}
+}
+
+// Publish calls handlers subscribed to the type of the event.
+// A panic of a handler is returned as an error, and the rest of handlers are still called.
+func (b *Bus) Publish(e Event) (errs []error) {
+	b.mu.RLock()
+	subscriptions := b.subscriptions
+	b.mu.RUnlock()
+
+	for _, s := range subscriptions {
+		if s.types != nil && !s.types[e.Type] {
+			continue
+		}
+		if err := handle(s.handler, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func handle(h Handler, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler of '%s' event panicked: %v", e.Type, r)
+		}
+	}()
+	h.Handle(e)
+	return nil
+}
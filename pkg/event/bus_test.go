@@ -0,0 +1,39 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus(t *testing.T) {
+	var bus Bus
+	var got []string
+	record := func(name string) Handler {
+		return HandlerFunc(func(e Event) { got = append(got, name+":"+e.Type.String()) })
+	}
+	unsubscribeAll := bus.Subscribe(record("all"))
+	bus.Subscribe(record("inactive"), SuspectedInactive)
+	bus.Subscribe(HandlerFunc(func(e Event) { panic("revoke failed") }), SuspectedInactive)
+	bus.Subscribe(record("endpoints"), EndpointIPUpdated, EndpointUpdated)
+
+	assert.Nil(t, bus.Publish(Event{Type: Handshake}))
+	assert.Nil(t, bus.Publish(Event{Type: EndpointUpdated}))
+	errs := bus.Publish(Event{Type: SuspectedInactive})
+	if assert.Len(t, errs, 1) {
+		assert.EqualError(t, errs[0], "handler of 'suspected inactive' event panicked: revoke failed")
+	}
+	assert.Equal(t, []string{
+		"all:handshake",
+		"all:endpoint updated",
+		"endpoints:endpoint updated",
+		"all:suspected inactive",
+		"inactive:suspected inactive",
+	}, got)
+
+	got = nil
+	unsubscribeAll()
+	unsubscribeAll()
+	bus.Publish(Event{Type: EndpointIPUpdated})
+	assert.Equal(t, []string{"endpoints:endpoint_ip updated"}, got)
+}
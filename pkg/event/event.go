@@ -0,0 +1,107 @@
+// Package event is the model of events detected from the status of peers.
+// Events are written to the event log, stored in the event history, and published to
+// handlers subscribed to Bus.
+package event
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is the kind of events, which is 'event' field of event log.
+type Type string
+
+const (
+	// Statistics is the final transferred bytes of the last endpoint before it changes
+	Statistics Type = "statistics"
+	// EndpointIPUpdated is the IP address of the endpoint changed
+	EndpointIPUpdated Type = "endpoint_ip updated"
+	// EndpointUpdated is the port of the endpoint changed
+	EndpointUpdated Type = "endpoint updated"
+	// Handshake is the latest handshake changed
+	Handshake Type = "handshake"
+	// SuspectedInactive is no handshake and transfer for a while
+	SuspectedInactive Type = "suspected inactive"
+)
+
+// Types are all types of events.
+var Types = []Type{Statistics, EndpointIPUpdated, EndpointUpdated, Handshake, SuspectedInactive}
+
+func (t Type) String() string {
+	return string(t)
+}
+
+// PeerStat is a line of 'wg show all dump'.
+type PeerStat struct {
+	PublicKey       string
+	Endpoint        string
+	LatestHandshake time.Time
+	TransferRX      uint64
+	TransferTX      uint64
+}
+
+// Labels are 'key=value' annotations of the peer, e.g. owner=alice
+type Labels map[string]string
+
+// Keys returns label names in sorted order.
+func (l Labels) Keys() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String returns labels in Prometheus format, e.g. {owner="alice",team="infra"}
+func (l Labels) String() string {
+	var pairs []string
+	for _, k := range l.Keys() {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, strconv.Quote(l[k])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Peer is the status of a peer at the event. It is also the state kept between checks,
+// which is stored in the database as JSON, so fields must not be renamed.
+type Peer struct {
+	PeerStat
+	EndpointIP                 string
+	TransferredRXPerEndpoint   uint64
+	TransferredTXPerEndpoint   uint64
+	TransferredRXPerEndpointIP uint64
+	TransferredTXPerEndpointIP uint64
+	SuspectedInactive          bool
+}
+
+// Event is an event of a peer.
+type Event struct {
+	Type Type
+	// Time is 'event_time' field, the latest handshake of the peer
+	Time         time.Time
+	FriendlyName string
+	Labels       Labels
+	Peer         Peer
+	// Message is 'message' field rendered from the template of Type
+	Message string
+	// InactiveMinutes is the minutes since the latest handshake of SuspectedInactive
+	InactiveMinutes int64
+}
+
+// Handler receives events, e.g. to deliver them to other systems.
+// Handle is called synchronously in the check, so it should not block for long.
+// Start a goroutine for slow work like requests to other systems.
+type Handler interface {
+	Handle(e Event)
+}
+
+// HandlerFunc is a function used as Handler.
+type HandlerFunc func(e Event)
+
+// Handle calls f(e).
+func (f HandlerFunc) Handle(e Event) {
+	f(e)
+}
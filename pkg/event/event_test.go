@@ -0,0 +1,50 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Peer is stored in the database, so the JSON must be readable by older versions.
+func TestPeer_JSON(t *testing.T) {
+	peer := Peer{
+		PeerStat: PeerStat{
+			PublicKey:       "i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=",
+			Endpoint:        "192.0.2.1:51820",
+			LatestHandshake: time.Unix(1599229650, 0).UTC(),
+			TransferRX:      1000,
+			TransferTX:      2000,
+		},
+		EndpointIP:                 "192.0.2.1",
+		TransferredRXPerEndpoint:   1,
+		TransferredTXPerEndpoint:   2,
+		TransferredRXPerEndpointIP: 3,
+		TransferredTXPerEndpointIP: 4,
+		SuspectedInactive:          true,
+	}
+	data, err := json.Marshal(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"PublicKey":"i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA=","Endpoint":"192.0.2.1:51820","LatestHandshake":"2020-09-04T14:27:30Z","TransferRX":1000,"TransferTX":2000,"EndpointIP":"192.0.2.1","TransferredRXPerEndpoint":1,"TransferredTXPerEndpoint":2,"TransferredRXPerEndpointIP":3,"TransferredTXPerEndpointIP":4,"SuspectedInactive":true}`
+	assert.Equal(t, want, string(data))
+}
+
+func TestHandlerFunc(t *testing.T) {
+	var got []Type
+	var h Handler = HandlerFunc(func(e Event) { got = append(got, e.Type) })
+	for _, typ := range Types {
+		h.Handle(Event{Type: typ})
+	}
+	assert.Equal(t, []Type{"statistics", "endpoint_ip updated", "endpoint updated", "handshake", "suspected inactive"}, got)
+}
+
+func TestLabels(t *testing.T) {
+	labels := Labels{"team": "infra", "owner": "alice"}
+	assert.Equal(t, []string{"owner", "team"}, labels.Keys())
+	assert.Equal(t, `{owner="alice",team="infra"}`, labels.String())
+	assert.Equal(t, "{}", Labels(nil).String())
+}
@@ -0,0 +1,67 @@
+package wglogger_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/livesense-inc/wg-logger/pkg/event"
+	"github.com/livesense-inc/wg-logger/pkg/wglogger"
+)
+
+// Run wg-logger in your program, and react to events with your code.
+func Example() {
+	store, err := wglogger.OpenStore("bbolt", "/var/lib/my-vpn/wg-logger.db")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	wgl := &wglogger.WGLogger{
+		Cache:                      store,
+		Interval:                   30,
+		SuspectedInactiveThreshold: 60 * 24,
+		WgCommandPath:              "/usr/bin/wg",
+	}
+	wgl.Subscribe(event.HandlerFunc(func(e event.Event) {
+		// e.g. remove the peer from the WireGuard config file
+		fmt.Printf("revoke %s, last handshake was %d minutes ago\n", e.Peer.PublicKey, e.InactiveMinutes)
+	}), event.SuspectedInactive)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := wgl.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Collect the status of peers from another source than 'wg show all dump'.
+func ExampleCollectorFunc() {
+	store, err := wglogger.OpenStore("sqlite", "/var/lib/my-vpn/wg-logger.sqlite")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	wgl := &wglogger.WGLogger{
+		Cache:                      store,
+		Interval:                   30,
+		SuspectedInactiveThreshold: 30,
+		Collector: wglogger.CollectorFunc(func() ([]wglogger.PeerStat, error) {
+			return fetchPeersFromAgent()
+		}),
+	}
+	if err := wgl.Start(); err != nil {
+		log.Fatal(err)
+	}
+	// ...
+	if err := wgl.Stop(); err != nil {
+		log.Print(err)
+	}
+}
+
+func fetchPeersFromAgent() ([]wglogger.PeerStat, error) {
+	return nil, nil
+}
@@ -0,0 +1,94 @@
+package wglogger
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/config"
+	"github.com/livesense-inc/wg-logger/pkg/event"
+)
+
+// MessageData is the data of message templates, e.g. '{{.FriendlyName}} connected from {{.Peer.EndpointIP}}'
+type MessageData struct {
+	Event        string
+	FriendlyName string
+	Labels       event.Labels
+	Peer         WGPeerStatLog
+	// InactiveMinutes is the minutes since the latest handshake
+	InactiveMinutes int64
+}
+
+var messageFuncs = template.FuncMap{
+	// bytes formats transferred bytes, e.g. {{bytes .Peer.TransferredRXPerEndpoint}}
+	"bytes": bytesReadable,
+}
+
+// Messages are templates of 'message' field by event names.
+type Messages map[string]*template.Template
+
+// defaultMessages are the default templates of config, same as the command uses.
+var defaultMessages, _ = ParseMessages(config.GetDefault().Messages.Templates())
+
+// ParseMessages parses templates by event names, and renders them with sample data
+// to find unknown fields at startup. Problems are returned as '<key>: <reason>',
+// where key is the key in config file, e.g. 'messages.endpoint_ip_updated'.
+func ParseMessages(texts map[string]string) (Messages, []string) {
+	events := make([]string, 0, len(texts))
+	for event := range texts {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	templates := make(Messages, len(texts))
+	var problems []string
+	for _, event := range events {
+		key := "messages." + strings.Replace(event, " ", "_", -1)
+		t, err := template.New(key).Option("missingkey=zero").Funcs(messageFuncs).Parse(texts[event])
+		if err == nil {
+			err = t.Execute(&bytes.Buffer{}, sampleMessageData(event))
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		templates[event] = t
+	}
+	return templates, problems
+}
+
+func sampleMessageData(name string) MessageData {
+	return MessageData{
+		Event:        name,
+		FriendlyName: "1st person",
+		Labels:       event.Labels{"team": "infra"},
+		Peer: WGPeerStatLog{
+			PeerStat: PeerStat{
+				PublicKey:       "JCuH+nwDMv9NXE3vm0rA9bZxkUXHE5/nUwtdt+y1kxo=",
+				Endpoint:        "192.0.2.1:51820",
+				LatestHandshake: time.Unix(0, 0),
+			},
+			EndpointIP: "192.0.2.1",
+		},
+	}
+}
+
+// render returns the message of the event, with the default templates when m is nil.
+// Templates are validated at startup, so errors are written in the message rather than dropping the event.
+func (m Messages) render(data MessageData) string {
+	if m == nil {
+		m = defaultMessages
+	}
+	t, ok := m[data.Event]
+	if !ok {
+		return data.Event
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return fmt.Sprintf("%s (message template error: %v)", data.Event, err)
+	}
+	return buf.String()
+}
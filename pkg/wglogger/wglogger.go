@@ -0,0 +1,471 @@
+// Package wglogger runs wg-logger as a library. WGLogger checks the status of WireGuard peers
+// every Interval, writes events to the event log and the event history, and publishes them
+// to handlers subscribed with Subscribe, e.g. to revoke a peer suspected inactive.
+//
+//	wgl := &wglogger.WGLogger{
+//		Cache:                      store,
+//		Interval:                   30,
+//		SuspectedInactiveThreshold: 30,
+//	}
+//	wgl.Subscribe(event.HandlerFunc(revoke), event.SuspectedInactive)
+//	err := wgl.Run(ctx)
+package wglogger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/internal/detect"
+	"github.com/livesense-inc/wg-logger/internal/kvs"
+	"github.com/livesense-inc/wg-logger/internal/peerdir"
+	"github.com/livesense-inc/wg-logger/internal/wgconf"
+	"github.com/livesense-inc/wg-logger/internal/wgpeerstat"
+	"github.com/livesense-inc/wg-logger/pkg/event"
+	"github.com/rs/zerolog"
+)
+
+// StateBucket is the bucket of the database to store states of peers.
+const StateBucket = "main"
+
+type (
+	// Store keeps states of peers and the event history, see OpenStore.
+	Store = kvs.Store
+	// Record is an entry of the event history.
+	Record = kvs.Record
+	// Query selects records of the event history.
+	Query = kvs.Query
+	// Entry is an entry of Dump and Restore of Store.
+	Entry = kvs.Entry
+	// WGConf is the WireGuard config file, which has friendly names and labels of peers.
+	WGConf = wgconf.WGConf
+	// PeerStat is the status of a peer collected by Collector.
+	PeerStat = event.PeerStat
+	// Directory looks up names and labels of peers by public keys, see OpenDirectory.
+	// Lookup may return entries found with error, when some of them are available.
+	Directory = peerdir.Provider
+	// DirectoryEntry is a peer found in Directory.
+	DirectoryEntry = peerdir.Entry
+	// Recorder records outputs of 'wg show all dump' for replay, see NewRecorder.
+	Recorder = wgpeerstat.Recorder
+)
+
+const (
+	// PrecedenceWGConf prefers names and labels in the WireGuard config file to Directory (default)
+	PrecedenceWGConf = peerdir.PrecedenceWGConf
+	// PrecedenceDirectory prefers names and labels in Directory
+	PrecedenceDirectory = peerdir.PrecedenceDirectory
+)
+
+// OpenStore opens the database of driver, 'bbolt' or 'sqlite', with StateBucket.
+func OpenStore(driver string, path string) (Store, error) {
+	return kvs.OpenStore(driver, path, StateBucket)
+}
+
+// OpenWGConf opens the WireGuard config file for friendly names and labels.
+func OpenWGConf(path string) (*WGConf, error) {
+	return wgconf.New(path)
+}
+
+// OpenDirectory opens the peer directory file, .csv, .json, .yaml or .yml.
+// The file is reloaded when it is modified.
+func OpenDirectory(path string) (Directory, error) {
+	f, err := peerdir.NewFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// NewRecorder returns the recorder which writes every N-th output into dir,
+// and removes ones older than maxDays. 0 keeps all.
+func NewRecorder(dir string, every int64, maxDays int64) *Recorder {
+	return wgpeerstat.NewRecorder(dir, every, maxDays)
+}
+
+// ParseDump parses lines of 'wg show all dump', lines which are not peers are skipped.
+func ParseDump(lines []string) []PeerStat {
+	parsed := wgpeerstat.ParseDump(lines)
+	stats := make([]PeerStat, 0, len(parsed))
+	for _, s := range parsed {
+		stats = append(stats, PeerStat(s))
+	}
+	return stats
+}
+
+// Collector returns the status of peers, e.g. from 'wg show all dump' of another host.
+type Collector interface {
+	Collect() ([]PeerStat, error)
+}
+
+// CollectorFunc is a function used as Collector.
+type CollectorFunc func() ([]PeerStat, error)
+
+// Collect calls f().
+func (f CollectorFunc) Collect() ([]PeerStat, error) {
+	return f()
+}
+
+func bytesReadable(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// WGPeerStatLog is the state of a peer written in event logs as 'peer' object.
+type WGPeerStatLog event.Peer
+
+func (s WGPeerStatLog) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("public_key", s.PublicKey).
+		Str("endpoint", s.Endpoint).
+		Str("endpoint_ip", s.EndpointIP).
+		Time("latest_handshake", s.LatestHandshake).
+		Str("transfered_rx_per_endpoint", bytesReadable(s.TransferredRXPerEndpoint)).
+		Str("transfered_tx_per_endpoint", bytesReadable(s.TransferredTXPerEndpoint)).
+		Str("transfered_rx_per_endpoint_ip", bytesReadable(s.TransferredRXPerEndpointIP)).
+		Str("transfered_tx_per_endpoint_ip", bytesReadable(s.TransferredTXPerEndpointIP))
+}
+
+// WGLogger detects events of peers. Cache, Interval and SuspectedInactiveThreshold are required,
+// and the others are optional.
+type WGLogger struct {
+	Cache Store
+	// WGConf has friendly names and labels of peers
+	WGConf *WGConf
+	// PeerDir has names and labels of peers too, and PeerDirPrecedence is
+	// PrecedenceWGConf or PrecedenceDirectory when both describe a peer
+	PeerDir           Directory
+	PeerDirPrecedence string
+	// EventLogger writes events, and DaemonLogger writes logs of wg-logger itself.
+	// Logs are discarded when they are nil.
+	EventLogger  *zerolog.Logger
+	DaemonLogger *zerolog.Logger
+	// Messages are templates of 'message' field, the default templates of the command are used when it is nil
+	Messages Messages
+	// Interval is the interval time in seconds to check
+	Interval int64
+	// SuspectedInactiveThreshold is the threshold time in minutes to detect 'suspected inactive'
+	SuspectedInactiveThreshold int64
+	WgCommandPath              string
+	// Now is the clock of detection, time.Now when nil. Replay sets the time of snapshots.
+	Now func() time.Time
+	// Collector returns the status of peers, 'wg show all dump' of WgCommandPath when nil
+	Collector Collector
+	// Recorder records outputs of 'wg show all dump' for replay, nil disables it
+	Recorder *Recorder
+	// HistoryMaxAge is the age of event history records to remove every hour, 0 keeps all
+	HistoryMaxAge time.Duration
+
+	bus event.Bus
+
+	pruneMu  sync.Mutex
+	prunedAt time.Time
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan error
+}
+
+// Subscribe adds the handler for events of types, or all events when types are omitted.
+// It can be called while running. The returned function removes the handler.
+func (wgl *WGLogger) Subscribe(h event.Handler, types ...event.Type) (unsubscribe func()) {
+	return wgl.bus.Subscribe(h, types...)
+}
+
+// Start runs Run in background until Stop is called.
+func (wgl *WGLogger) Start() error {
+	wgl.mu.Lock()
+	defer wgl.mu.Unlock()
+	if wgl.done != nil {
+		return errors.New("wg-logger is already started")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	wgl.cancel, wgl.done = cancel, done
+	go func() {
+		done <- wgl.Run(ctx)
+	}()
+	return nil
+}
+
+// Stop stops WGLogger started by Start, and waits for the running check.
+// It returns the error of Run.
+func (wgl *WGLogger) Stop() error {
+	wgl.mu.Lock()
+	defer wgl.mu.Unlock()
+	if wgl.done == nil {
+		return errors.New("wg-logger is not started")
+	}
+	wgl.cancel()
+	err := <-wgl.done
+	wgl.cancel, wgl.done = nil, nil
+	return err
+}
+
+// Run checks the status of peers at once and every Interval until ctx is done.
+// It waits for running checks before returning.
+func (wgl *WGLogger) Run(ctx context.Context) error {
+	if wgl.Cache == nil {
+		return errors.New("Cache is required")
+	}
+	if wgl.Interval <= 0 {
+		return fmt.Errorf("Interval must be greater than 0, got %d", wgl.Interval)
+	}
+	if wgl.SuspectedInactiveThreshold <= 0 {
+		return fmt.Errorf("SuspectedInactiveThreshold must be greater than 0, got %d", wgl.SuspectedInactiveThreshold)
+	}
+	wgl.setDefaults()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	check := func() {
+		defer wg.Done()
+		if err := wgl.check(); err != nil {
+			wgl.DaemonLogger.Warn().
+				Err(err).
+				Msg("Cannot check WireGuard status")
+		}
+		wgl.pruneHistory()
+	}
+	wg.Add(1)
+	check()
+	for {
+		select {
+		case <-time.After(time.Duration(wgl.Interval) * time.Second):
+			wg.Add(1)
+			go check()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Check checks the status of peers once, e.g. for each snapshot of replay.
+func (wgl *WGLogger) Check() error {
+	wgl.setDefaults()
+	err := wgl.check()
+	wgl.pruneHistory()
+	return err
+}
+
+func (wgl *WGLogger) setDefaults() {
+	nop := zerolog.Nop()
+	if wgl.EventLogger == nil {
+		wgl.EventLogger = &nop
+	}
+	if wgl.DaemonLogger == nil {
+		wgl.DaemonLogger = &nop
+	}
+}
+
+func (wgl *WGLogger) now() time.Time {
+	if wgl.Now != nil {
+		return wgl.Now()
+	}
+	return time.Now()
+}
+
+func (wgl *WGLogger) collect() ([]PeerStat, error) {
+	if wgl.Collector != nil {
+		return wgl.Collector.Collect()
+	}
+	lines, err := wgpeerstat.ReadDump(wgl.WgCommandPath)
+	if err != nil {
+		return nil, err
+	}
+	if wgl.Recorder != nil {
+		if err := wgl.Recorder.Record(wgl.now(), lines); err != nil {
+			wgl.DaemonLogger.Warn().
+				Err(err).
+				Msgf("Cannot record snapshot into '%s'", wgl.Recorder.Dir)
+		}
+	}
+	return ParseDump(lines), nil
+}
+
+// historyPruneInterval is the interval to remove old records of the event history
+const historyPruneInterval = time.Hour
+
+// pruneHistory removes records older than HistoryMaxAge, at most once in historyPruneInterval.
+func (wgl *WGLogger) pruneHistory() {
+	if wgl.HistoryMaxAge <= 0 {
+		return
+	}
+	wgl.pruneMu.Lock()
+	defer wgl.pruneMu.Unlock()
+	now := wgl.now()
+	if now.Sub(wgl.prunedAt) < historyPruneInterval {
+		return
+	}
+	wgl.prunedAt = now
+	n, err := wgl.Cache.PruneHistory(now.Add(-wgl.HistoryMaxAge))
+	if err != nil {
+		wgl.DaemonLogger.Error().
+			Err(err).
+			Msg("Cannot remove old event history")
+		return
+	}
+	if n > 0 {
+		wgl.DaemonLogger.Info().
+			Int("records", n).
+			Msg("old event history was removed")
+	}
+}
+
+// publish writes the event to the event log and the event history, and publishes it to subscribers.
+func (wgl *WGLogger) publish(e event.Event) {
+	wgl.logEvent(e)
+	wgl.appendHistory(e)
+	for _, err := range wgl.bus.Publish(e) {
+		wgl.DaemonLogger.Error().
+			Err(err).
+			Msgf("Cannot handle '%s' event of '%s'", e.Type, e.Peer.PublicKey)
+	}
+}
+
+// logEvent writes the event to the event log.
+func (wgl *WGLogger) logEvent(e event.Event) {
+	wgl.EventLogger.Log().
+		Str("event", e.Type.String()).
+		Str("friendly_name", e.FriendlyName).
+		Object("labels", wgconf.Labels(e.Labels)).
+		Time("event_time", e.Time).
+		Object("peer", WGPeerStatLog(e.Peer)).
+		Msg(e.Message)
+}
+
+// appendHistory records the event into the event history of the database.
+func (wgl *WGLogger) appendHistory(e event.Event) {
+	data, err := json.Marshal(e.Peer)
+	if err != nil {
+		wgl.DaemonLogger.Error().
+			Err(err).
+			Msgf("Cannot marshal '%s' data", e.Peer.PublicKey)
+		return
+	}
+	err = wgl.Cache.AppendEvent(kvs.Record{
+		Key:   e.Peer.PublicKey,
+		Time:  wgl.now(),
+		Event: e.Type.String(),
+		Data:  data,
+	})
+	if err != nil {
+		wgl.DaemonLogger.Error().
+			Err(err).
+			Msgf("Cannot store '%s' history", e.Peer.PublicKey)
+	}
+}
+
+func (wgl *WGLogger) check() (err error) {
+	wgl.DaemonLogger.Debug().
+		Msg("check")
+	// replay runs without wireguard config file
+	names, labels := map[string]string{}, map[string]wgconf.Labels{}
+	if wgl.WGConf != nil {
+		names, err = wgl.WGConf.GetFriendlyNameMap()
+		if err != nil {
+			wgl.DaemonLogger.Error().
+				Err(err).
+				Msgf("Cannot read '%s'", wgl.WGConf.Path)
+			return
+		}
+
+		labels, err = wgl.WGConf.GetLabelsMap()
+		if err != nil {
+			wgl.DaemonLogger.Error().
+				Err(err).
+				Msgf("Cannot read '%s'", wgl.WGConf.Path)
+			return
+		}
+	}
+
+	stats, err := wgl.collect()
+	if err != nil {
+		wgl.DaemonLogger.Error().
+			Err(err).
+			Msg("Cannot check wg-tool")
+		return
+	}
+
+	if wgl.PeerDir != nil {
+		publicKeys := make([]string, 0, len(stats))
+		for _, stat := range stats {
+			publicKeys = append(publicKeys, stat.PublicKey)
+		}
+		entries, err := wgl.PeerDir.Lookup(publicKeys)
+		if err != nil {
+			// continue with names in wireguard config file and entries available
+			wgl.DaemonLogger.Error().
+				Err(err).
+				Msgf("Cannot look up peer directory '%s'", wgl.PeerDir)
+		}
+		names, labels = peerdir.Merge(names, labels, entries, wgl.PeerDirPrecedence)
+	}
+
+	detector := detect.Detector{
+		SuspectedInactiveThreshold: time.Minute * time.Duration(wgl.SuspectedInactiveThreshold),
+	}
+	for _, stat := range stats {
+		lastStat := detect.Initial()
+		if v := wgl.Cache.Get(stat.PublicKey); v != nil {
+			if err = json.Unmarshal(v, &lastStat); err != nil {
+				wgl.DaemonLogger.Error().
+					Err(err).
+					Msgf("Invalid data was inserted into database for '%s'", stat.PublicKey)
+				return err
+			}
+		}
+
+		// if counter was rotated, current value is used as transfered bytes.
+		rotatedRX, rotatedTX := detect.Rotated(lastStat, stat)
+		if rotatedRX {
+			wgl.DaemonLogger.Info().
+				Object("peer", wgpeerstat.PeerStat(stat)).
+				Msg("TransferRX counter was rotated")
+		}
+		if rotatedTX {
+			wgl.DaemonLogger.Info().
+				Object("peer", wgpeerstat.PeerStat(stat)).
+				Msg("TransferTX counter was rotated")
+		}
+
+		curStat, events := detector.Detect(lastStat, stat, wgl.now())
+		for _, e := range events {
+			e.FriendlyName = names[stat.PublicKey]
+			e.Labels = event.Labels(labels[stat.PublicKey])
+			e.Message = wgl.Messages.render(MessageData{
+				Event:           e.Type.String(),
+				FriendlyName:    e.FriendlyName,
+				Labels:          e.Labels,
+				Peer:            WGPeerStatLog(e.Peer),
+				InactiveMinutes: e.InactiveMinutes,
+			})
+			wgl.publish(e)
+		}
+
+		// save current stat
+		data, err := json.Marshal(curStat)
+		if err != nil {
+			wgl.DaemonLogger.Error().
+				Err(err).
+				Msgf("Cannot marshal '%s' data", curStat.PublicKey)
+		}
+		if err = wgl.Cache.Set(curStat.PublicKey, data); err != nil {
+			wgl.DaemonLogger.
+				Err(err).
+				Msgf("Cannot store '%s' data", curStat.PublicKey)
+		}
+	}
+
+	return nil
+}
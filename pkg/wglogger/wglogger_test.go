@@ -0,0 +1,196 @@
+package wglogger
+
+import (
+	"bytes"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livesense-inc/wg-logger/pkg/event"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+const publicKey = "i+VdaJmF7mSlQlDQnEuFbo1JFicB2X054uN0DF5MICA="
+
+func openStore(t *testing.T) Store {
+	store, err := OpenStore("bbolt", filepath.Join(t.TempDir(), "wg-logger.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestWGLogger_Check(t *testing.T) {
+	handshake := time.Unix(1599229650, 0)
+	now := handshake
+	stat := PeerStat{PublicKey: publicKey, Endpoint: "192.0.2.1:51820", LatestHandshake: handshake, TransferRX: 1000, TransferTX: 2000}
+	messages, problems := ParseMessages(map[string]string{
+		"suspected inactive": "{{.FriendlyName}} is inactive for {{.InactiveMinutes}} minutes",
+	})
+	assert.Nil(t, problems)
+
+	var buf bytes.Buffer
+	eventLogger := zerolog.New(&buf)
+	store := openStore(t)
+	wgl := &WGLogger{
+		Cache:                      store,
+		EventLogger:                &eventLogger,
+		Messages:                   messages,
+		Interval:                   30,
+		SuspectedInactiveThreshold: 30,
+		Now:                        func() time.Time { return now },
+		Collector: CollectorFunc(func() ([]PeerStat, error) {
+			return []PeerStat{stat}, nil
+		}),
+	}
+	var got []event.Event
+	wgl.Subscribe(event.HandlerFunc(func(e event.Event) { got = append(got, e) }), event.EndpointIPUpdated, event.SuspectedInactive)
+
+	if err := wgl.Check(); err != nil {
+		t.Fatal(err)
+	}
+	now = handshake.Add(45 * time.Minute)
+	if err := wgl.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, event.EndpointIPUpdated, got[0].Type)
+		assert.Equal(t, "192.0.2.1", got[0].Peer.EndpointIP)
+		assert.Equal(t, "endpoint_ip updated", got[0].Message)
+		assert.Equal(t, event.SuspectedInactive, got[1].Type)
+		assert.Equal(t, int64(45), got[1].InactiveMinutes)
+		assert.Equal(t, " is inactive for 45 minutes", got[1].Message)
+	}
+	// statistics of the first check is written to the event log and the history, not to the handler
+	assert.Equal(t, 3, bytes.Count(buf.Bytes(), []byte("\n")))
+	assert.Contains(t, buf.String(), `{"event":"suspected inactive","friendly_name":"","labels":{},"event_time":"2020-09-04T`)
+	records, err := store.History(Query{Key: publicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, records, 3)
+}
+
+type stubDirectory map[string]DirectoryEntry
+
+func (d stubDirectory) Lookup(publicKeys []string) (map[string]DirectoryEntry, error) {
+	return d, nil
+}
+
+func (d stubDirectory) String() string {
+	return "stub"
+}
+
+func TestWGLogger_PeerDir(t *testing.T) {
+	var buf bytes.Buffer
+	eventLogger := zerolog.New(&buf)
+	wgl := &WGLogger{
+		Cache:                      openStore(t),
+		PeerDir:                    stubDirectory{publicKey: {PublicKey: publicKey, Name: "alice", Team: "infra"}},
+		PeerDirPrecedence:          PrecedenceDirectory,
+		EventLogger:                &eventLogger,
+		Interval:                   30,
+		SuspectedInactiveThreshold: 30,
+		Collector: CollectorFunc(func() ([]PeerStat, error) {
+			return []PeerStat{{PublicKey: publicKey, Endpoint: "192.0.2.1:51820", LatestHandshake: time.Now()}}, nil
+		}),
+	}
+	if err := wgl.Check(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, buf.String(), `"friendly_name":"alice","labels":{"team":"infra"}`)
+
+	dir, err := OpenDirectory("../../test/peers.yaml")
+	if assert.NoError(t, err) {
+		entries, err := dir.Lookup([]string{publicKey})
+		assert.NoError(t, err)
+		assert.Equal(t, "Alice laptop", entries[publicKey].Name)
+	}
+}
+
+func TestWGLogger_PruneHistory(t *testing.T) {
+	now := time.Unix(1599229650, 0)
+	store := openStore(t)
+	for _, age := range []time.Duration{48 * time.Hour, 12 * time.Hour} {
+		if err := store.AppendEvent(Record{Key: publicKey, Time: now.Add(-age), Event: "handshake", Data: []byte(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wgl := &WGLogger{
+		Cache:                      store,
+		Interval:                   30,
+		SuspectedInactiveThreshold: 30,
+		HistoryMaxAge:              24 * time.Hour,
+		Now:                        func() time.Time { return now },
+		Collector:                  CollectorFunc(func() ([]PeerStat, error) { return nil, nil }),
+	}
+	if err := wgl.Check(); err != nil {
+		t.Fatal(err)
+	}
+	records, err := store.History(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, records, 1) {
+		assert.True(t, records[0].Time.Equal(now.Add(-12*time.Hour)))
+	}
+}
+
+func TestWGLogger_StartStop(t *testing.T) {
+	var once sync.Once
+	checked := make(chan struct{})
+	wgl := &WGLogger{
+		Cache:                      openStore(t),
+		Interval:                   30,
+		SuspectedInactiveThreshold: 30,
+		Collector: CollectorFunc(func() ([]PeerStat, error) {
+			once.Do(func() { close(checked) })
+			return []PeerStat{{PublicKey: publicKey, Endpoint: "192.0.2.1:51820", LatestHandshake: time.Now()}}, nil
+		}),
+	}
+	assert.EqualError(t, wgl.Stop(), "wg-logger is not started")
+	if err := wgl.Start(); err != nil {
+		t.Fatal(err)
+	}
+	assert.EqualError(t, wgl.Start(), "wg-logger is already started")
+	select {
+	case <-checked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not checked after Start")
+	}
+	assert.NoError(t, wgl.Stop())
+
+	// errors of Run are returned by Stop
+	invalid := &WGLogger{Interval: 30, SuspectedInactiveThreshold: 30}
+	assert.NoError(t, invalid.Start())
+	assert.EqualError(t, invalid.Stop(), "Cache is required")
+}
+
+func TestParseMessages(t *testing.T) {
+	_, problems := ParseMessages(map[string]string{
+		"handshake":  "{{.Peer.Unknown}}",
+		"statistics": "{{bytes .Peer.TransferRX}",
+	})
+	if assert.Len(t, problems, 2) {
+		assert.Equal(t, `messages.handshake: template: messages.handshake:1:7: executing "messages.handshake" at <.Peer.Unknown>: can't evaluate field Unknown in type wglogger.WGPeerStatLog`, problems[0])
+		// syntax errors depend on the version of Go
+		assert.Contains(t, problems[1], "messages.statistics: template: messages.statistics:1: ")
+	}
+}
+
+func TestMessages_RenderDefault(t *testing.T) {
+	data := sampleMessageData("suspected inactive")
+	data.InactiveMinutes = 45
+	// nil uses the default templates of the command
+	var messages Messages
+	assert.Equal(t, "last handshake was 45 minutes ago.", messages.render(data))
+	assert.Equal(t, "status update", messages.render(sampleMessageData("handshake")))
+
+	messages, problems := ParseMessages(map[string]string{"handshake": "{{.FriendlyName}}"})
+	assert.Nil(t, problems)
+	assert.Equal(t, "suspected inactive", messages.render(data))
+}